@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,8 +14,45 @@ import (
 )
 
 type RPCClient struct {
-	GetBlockByHash   func(hash string) *blockchain.Block
-	GetBlockByHeight func(height uint64) *blockchain.Block
+	GetBlockByHash         func(hash string) *blockchain.Block
+	GetBlockByHeight       func(height uint64) *blockchain.Block
+	GetTxOutSetInfo        func() *blockchain.TxOutSetInfo
+	GetBalance             func(address string) *blockchain.Balance
+	CreateWallet           func(name, mnemonicPassphrase, walletPassphrase string) (string, error)
+	RestoreWallet          func(name, mnemonic, mnemonicPassphrase, walletPassphrase string) error
+	LoadWallet             func(name string) error
+	UnloadWallet           func(name string) error
+	ListWallets            func() ([]blockchain.WalletInfo, error)
+	GetWalletBalance       func(wallet string) (*blockchain.Balance, error)
+	GetWalletHistory       func(wallet string) ([]blockchain.WalletTx, error)
+	NewAddress             func(wallet string) (string, error)
+	EncryptWallet          func(wallet, passphrase string) error
+	UnlockWallet           func(wallet, passphrase string, timeout int) error
+	LockWallet             func(wallet string) error
+	ChangeWalletPassphrase func(wallet, oldPassphrase, newPassphrase string) error
+	Send                   func(wallet, recipient string, amount, fee, feeRate int) (string, error)
+	SendData               func(wallet, data string, fee, feeRate int) (string, error)
+	FindData               func(data string) ([]blockchain.DataRecord, error)
+	GetTransaction         func(txID string) (*blockchain.TxInfo, error)
+	GetAddressBalance      func(address string) (*blockchain.Balance, error)
+	GetAddressUTXOs        func(address string) ([]blockchain.UTXO, error)
+	GetAddressHistory      func(address string, skip, count int) ([]blockchain.AddressTx, error)
+}
+
+// walletFlag selects the wallet a command acts on
+func walletFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "wallet",
+		Usage: "name of the loaded wallet to use, the node wallet if empty",
+	}
+}
+
+// feeRateFlag sets the fee of a transaction per byte of its estimated size, overriding --fee
+func feeRateFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:  "feerate",
+		Usage: "fee paid per byte of the transaction, overrides --fee if set",
+	}
 }
 
 func main() {
@@ -69,15 +107,438 @@ func main() {
 					return nil
 				},
 			},
-			// {
-			// 	Name: "createwallet",
-			// 	Action: func(ctx context.Context, cmd *cli.Command) error {
-			// 		if cmd.String("createwallet") != "" {
-			//
-			// 		}
-			// 		return nil
-			// 	},
-			// },
+			{
+				Name:  "gettxoutsetinfo",
+				Usage: "get statistics of the utxo set, including the total coins issued",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					info := client.GetTxOutSetInfo()
+					jsonBytes, err := json.MarshalIndent(info, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling utxo set info to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getbalance",
+				Usage: "get the balance of an address, with immature coinbase outputs reported separately",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address to query",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					bal := client.GetBalance(cmd.String("address"))
+					jsonBytes, err := json.MarshalIndent(bal, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling balance to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getaddressbalance",
+				Usage: "get the balance of an address from the address index of the node",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address to query",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					bal, err := client.GetAddressBalance(cmd.String("address"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(bal, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling balance to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getaddressutxos",
+				Usage: "list the utxos of an address from the address index of the node",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address to query",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					utxos, err := client.GetAddressUTXOs(cmd.String("address"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(utxos, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling utxos to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getaddresshistory",
+				Usage: "list the transactions of an address from the address index of the node, newest first",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address to query",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "skip",
+						Value: 0,
+						Usage: "number of newest transactions to skip",
+					},
+					&cli.IntFlag{
+						Name:  "count",
+						Value: 20,
+						Usage: "maximum number of transactions to list",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					history, err := client.GetAddressHistory(cmd.String("address"), int(cmd.Int("skip")), int(cmd.Int("count")))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(history, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling address history to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getnewaddress",
+				Usage: "get a fresh receiving address of a wallet",
+				Flags: []cli.Flag{
+					walletFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					address, err := client.NewAddress(cmd.String("wallet"))
+					if err != nil {
+						return err
+					}
+					fmt.Println(address)
+					return nil
+				},
+			},
+			{
+				Name:  "encryptwallet",
+				Usage: "encrypt a wallet with a passphrase, which locks it",
+				Flags: []cli.Flag{
+					walletFlag(),
+					&cli.StringFlag{
+						Name:     "passphrase",
+						Usage:    "passphrase to encrypt the wallet with",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.EncryptWallet(cmd.String("wallet"), cmd.String("passphrase"))
+				},
+			},
+			{
+				Name:  "unlockwallet",
+				Usage: "unlock a wallet so that it can spend and sign",
+				Flags: []cli.Flag{
+					walletFlag(),
+					&cli.StringFlag{
+						Name:     "passphrase",
+						Usage:    "passphrase of the wallet",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "timeout",
+						Value: 60,
+						Usage: "seconds after which the wallet is locked again",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.UnlockWallet(cmd.String("wallet"), cmd.String("passphrase"), int(cmd.Int("timeout")))
+				},
+			},
+			{
+				Name:  "lockwallet",
+				Usage: "lock a wallet",
+				Flags: []cli.Flag{
+					walletFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.LockWallet(cmd.String("wallet"))
+				},
+			},
+			{
+				Name:  "changewalletpassphrase",
+				Usage: "change the passphrase a wallet is encrypted with",
+				Flags: []cli.Flag{
+					walletFlag(),
+					&cli.StringFlag{
+						Name:     "old",
+						Usage:    "current passphrase of the wallet",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "new",
+						Usage:    "new passphrase of the wallet",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.ChangeWalletPassphrase(cmd.String("wallet"), cmd.String("old"), cmd.String("new"))
+				},
+			},
+			{
+				Name:  "send",
+				Usage: "pay an amount to an address from a wallet",
+				Flags: []cli.Flag{
+					walletFlag(),
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "address of the recipent",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:     "amount",
+						Usage:    "amount to send",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "fee",
+						Value: 1,
+						Usage: "fee paid by the transaction",
+					},
+					feeRateFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					txID, err := client.Send(cmd.String("wallet"), cmd.String("to"), int(cmd.Int("amount")), int(cmd.Int("fee")), int(cmd.Int("feerate")))
+					if err != nil {
+						return err
+					}
+					fmt.Println(txID)
+					return nil
+				},
+			},
+			{
+				Name:  "senddata",
+				Usage: "anchor data on the chain in a data carrier output paid for by a wallet",
+				Flags: []cli.Flag{
+					walletFlag(),
+					&cli.StringFlag{
+						Name:     "data",
+						Usage:    "hex encoded data to anchor, such as a document hash",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "fee",
+						Value: 1,
+						Usage: "fee paid by the transaction",
+					},
+					feeRateFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					txID, err := client.SendData(cmd.String("wallet"), cmd.String("data"), int(cmd.Int("fee")), int(cmd.Int("feerate")))
+					if err != nil {
+						return err
+					}
+					fmt.Println(txID)
+					return nil
+				},
+			},
+			{
+				Name:  "finddata",
+				Usage: "look up the data carrier outputs on the chain carrying the given data",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "data",
+						Usage:    "hex encoded data to look up",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					records, err := client.FindData(cmd.String("data"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(records, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling data records to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "gettransaction",
+				Usage: "look up a transaction by id along with its block and confirmations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "txid",
+						Usage:    "id of the transaction",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					info, err := client.GetTransaction(cmd.String("txid"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(info, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling transaction to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "createwallet",
+				Usage: "create and load a new wallet and print its recovery words",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "name of the wallet",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "mnemonic-passphrase",
+						Usage: "optional passphrase protecting the recovery words",
+					},
+					&cli.StringFlag{
+						Name:  "wallet-passphrase",
+						Usage: "passphrase to encrypt the wallet with, unencrypted if empty",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					words, err := client.CreateWallet(cmd.String("name"), cmd.String("mnemonic-passphrase"), cmd.String("wallet-passphrase"))
+					if err != nil {
+						return err
+					}
+					fmt.Println("Write down the recovery words of the wallet to restore it:")
+					fmt.Println(words)
+					return nil
+				},
+			},
+			{
+				Name:  "restorewallet",
+				Usage: "restore a wallet from its recovery words, read from stdin, and load it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "name of the wallet",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "mnemonic-passphrase",
+						Usage: "passphrase protecting the recovery words, if any",
+					},
+					&cli.StringFlag{
+						Name:  "wallet-passphrase",
+						Usage: "passphrase to encrypt the wallet with, unencrypted if empty",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					fmt.Print("Enter the recovery words of the wallet: ")
+					words, err := bufio.NewReader(os.Stdin).ReadString('\n')
+					if err != nil {
+						return fmt.Errorf("Error reading recovery words: %v", err)
+					}
+					return client.RestoreWallet(cmd.String("name"), words, cmd.String("mnemonic-passphrase"), cmd.String("wallet-passphrase"))
+				},
+			},
+			{
+				Name:  "loadwallet",
+				Usage: "load a saved wallet",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "name of the wallet",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.LoadWallet(cmd.String("name"))
+				},
+			},
+			{
+				Name:  "unloadwallet",
+				Usage: "unload a loaded wallet",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "name of the wallet",
+						Required: true,
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return client.UnloadWallet(cmd.String("name"))
+				},
+			},
+			{
+				Name:  "listwallets",
+				Usage: "list the saved wallets and whether they are loaded",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					wallets, err := client.ListWallets()
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(wallets, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling wallets to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getwalletbalance",
+				Usage: "get the balance of a wallet, with immature coinbase outputs reported separately",
+				Flags: []cli.Flag{
+					walletFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					bal, err := client.GetWalletBalance(cmd.String("wallet"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(bal, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling balance to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
+			{
+				Name:  "getwallethistory",
+				Usage: "get the transactions of a wallet on the chain, oldest first",
+				Flags: []cli.Flag{
+					walletFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					history, err := client.GetWalletHistory(cmd.String("wallet"))
+					if err != nil {
+						return err
+					}
+					jsonBytes, err := json.MarshalIndent(history, "", " ")
+					if err != nil {
+						fmt.Println("Error marshalling wallet history to json", err)
+					}
+					fmt.Println(string(jsonBytes))
+					return nil
+				},
+			},
 		},
 	}
 
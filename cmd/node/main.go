@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/shu8h0-null/minbit/core"
 	"github.com/shu8h0-null/minbit/core/logger"
@@ -56,6 +58,26 @@ func main() {
 			// 	Value: "",
 			// 	Usage: "Path to load wallet from",
 			// },
+			&cli.BoolFlag{
+				Name:  "restore-wallet",
+				Value: false,
+				Usage: "Restore the node wallet from its recovery words, read from stdin, and rescan the chain after syncing",
+			},
+			&cli.StringFlag{
+				Name:  "mnemonic-passphrase",
+				Value: "",
+				Usage: "Optional passphrase protecting the recovery words of a created or restored wallet",
+			},
+			&cli.StringFlag{
+				Name:  "wallet-passphrase",
+				Value: "",
+				Usage: "Passphrase encrypting a created or restored wallet, or an unencrypted wallet on load",
+			},
+			&cli.BoolFlag{
+				Name:  "addrindex",
+				Value: false,
+				Usage: "Keep an index of the utxos and transactions of every address, built from the chain on first use",
+			},
 			&cli.BoolFlag{
 				Name:  "serve",
 				Value: false,
@@ -75,16 +97,30 @@ func main() {
 			rpcAddr := cmd.String("rpc-addr")
 			minerMode := cmd.Bool("mine")
 			seed := cmd.Int64("seed")
+			restoreWallet := cmd.Bool("restore-wallet")
+			mnemonicPassphrase := cmd.String("mnemonic-passphrase")
+			walletPassphrase := cmd.String("wallet-passphrase")
+			addrIndex := cmd.Bool("addrindex")
 			if !netstack.CheckPortAvailability("127.0.0.1", port) {
-				return fmt.Errorf("Provied port: %s not available: %v", port)
+				return fmt.Errorf("Provied port: %d not available", port)
 			}
 
 			if serve && rpcAddr == "" {
 				return fmt.Errorf("Please provide an address for rpc.\n")
 			}
 
+			var mnemonic string
+			if restoreWallet {
+				fmt.Print("Enter the recovery words of the wallet: ")
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil {
+					return fmt.Errorf("Error reading recovery words: %v", err)
+				}
+				mnemonic = strings.TrimSpace(line)
+			}
+
 			ctxB := context.Background()
-			node, err := core.InitNode(ctxB, port, id, seed, minerMode)
+			node, err := core.InitNode(ctxB, port, id, seed, minerMode, mnemonic, mnemonicPassphrase, walletPassphrase, addrIndex)
 			if err != nil {
 				return fmt.Errorf("Error initialising node: %v", err)
 			}
@@ -94,6 +130,12 @@ func main() {
 				return fmt.Errorf("Error connecting to the target:%v\n", err)
 			}
 
+			if restoreWallet {
+				if err := node.RescanWallet(); err != nil {
+					return err
+				}
+			}
+
 			if serve {
 				handler := rpc.NewRPCHandler(node)
 				go func() {
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"fmt"
+)
+
+// AddressTx is a transaction of the main chain paying to or spending from an address
+type AddressTx struct {
+	TxID     string `json:"txid"`
+	Height   uint64 `json:"height"`
+	Position int    `json:"position"` // position of the transaction in its block
+}
+
+// SetAddrIndex enables or disables the address index. An enabled index is built from the main chain
+// unless it was built before. A disabled index is deleted, since it is no longer kept up to date.
+func (cs *ChainState) SetAddrIndex(enabled bool) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	store := cs.utxoSet.Store()
+	if !enabled {
+		cs.utxoSet.addrIndex = false
+		return store.DropAddrIndex()
+	}
+
+	built, err := store.HasAddrIndex()
+	if err != nil {
+		return err
+	}
+	if !built {
+		if err := cs.buildAddrIndex(); err != nil {
+			return fmt.Errorf("Error building address index: %v", err)
+		}
+	}
+	cs.utxoSet.addrIndex = true
+	return nil
+}
+
+// buildAddrIndex indexes the main chain by address, resolving the outputs its blocks spend with their undo records
+func (cs *ChainState) buildAddrIndex() error {
+	store := cs.utxoSet.Store()
+	if err := store.ResetAddrIndex(); err != nil {
+		return err
+	}
+
+	log.Info("Building address index of the main chain")
+	err := cs.blockchain.ForEachBlock(0, func(b *Block) error {
+		undo, err := cs.blockUndo(b)
+		if err != nil {
+			return err
+		}
+		return store.WriteAddrIndex(b, undo.Spent)
+	})
+	if err != nil {
+		return err
+	}
+	return store.MarkAddrIndex()
+}
+
+// AddressBalance returns the balance of address from the address index
+func (cs *ChainState) AddressBalance(address string) (Balance, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	utxos, err := cs.addressUTXOs(address)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	height := uint64(cs.blockchain.GetBlockchainHeight() + 1)
+	var bal Balance
+	for _, utxo := range utxos {
+		if utxo.IsMature(height) {
+			bal.Spendable += utxo.Value
+		} else {
+			bal.Immature += utxo.Value
+		}
+	}
+	return bal, nil
+}
+
+// AddressUTXOs returns the utxos of address from the address index
+func (cs *ChainState) AddressUTXOs(address string) ([]UTXO, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.addressUTXOs(address)
+}
+
+func (cs *ChainState) addressUTXOs(address string) ([]UTXO, error) {
+	if !cs.utxoSet.addrIndex {
+		return nil, ErrNoAddrIndex
+	}
+	return cs.utxoSet.Store().AddressUTXOs(address)
+}
+
+// AddressHistory returns a page of the transactions of address from the address index, newest first
+func (cs *ChainState) AddressHistory(address string, skip, count int) ([]AddressTx, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if !cs.utxoSet.addrIndex {
+		return nil, ErrNoAddrIndex
+	}
+	return cs.utxoSet.Store().AddressHistory(address, skip, count)
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// scanAddressUTXOs returns the utxos of address found by scanning the whole utxo set, sorted by outpoint
+func scanAddressUTXOs(cs *ChainState, address string) []UTXO {
+	var utxos []UTXO
+	for _, outputs := range cs.UTXOSet().UTXOs {
+		for _, utxo := range outputs {
+			if utxoAddr, err := ScriptPubKeyToAddress(utxo.ScriptPubKey); err == nil && utxoAddr == address {
+				utxos = append(utxos, utxo)
+			}
+		}
+	}
+	sortUTXOs(utxos)
+	return utxos
+}
+
+func sortUTXOs(utxos []UTXO) {
+	slices.SortFunc(utxos, func(a, b UTXO) int {
+		return cmp.Or(cmp.Compare(a.TxID, b.TxID), cmp.Compare(a.OutputIndex, b.OutputIndex))
+	})
+}
+
+// indexedAddress returns the utxos and the whole history of address from the address index
+func indexedAddress(t *testing.T, cs *ChainState, address string) ([]UTXO, []AddressTx) {
+	t.Helper()
+	utxos, err := cs.AddressUTXOs(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortUTXOs(utxos)
+	history, err := cs.AddressHistory(address, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utxos, history
+}
+
+func TestAddrIndex(t *testing.T) {
+	cs := newTestChainState(t)
+	if err := cs.SetAddrIndex(true); err != nil {
+		t.Fatal(err)
+	}
+	wallet := newTestWallet(t)
+	recipient := newTestWallet(t)
+	script, err := AddressToScriptPubKey(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pays the first output of the coinbase at height to the wallet
+	fund := func(height uint64, value int) *Transaction {
+		coinbase, err := cs.Blockchain().GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := newTestTx([]string{coinbase.TxData[0].TxID}, Subsidy(height)-value)
+		tx.Outputs = append(tx.Outputs, Output{Value: value, ScriptPubKey: script})
+		tx.TxID = tx.calculateID()
+		return tx
+	}
+	connect := func(tip *Block, tx *Transaction) *Block {
+		b := newTestChainBlock(t, cs, tip, 30, *tx)
+		if _, err := cs.ProcessBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity)
+	received := fund(0, 30)
+	tip = connect(tip, received)
+	sent, err := wallet.CreateTransaction(cs, recipient.Address, 10, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip = connect(tip, sent)
+	utxosBefore, historyBefore := indexedAddress(t, cs, wallet.Address)
+	balanceBefore, err := cs.AddressBalance(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := connect(tip, fund(1, 5))
+
+	utxos, history := indexedAddress(t, cs, wallet.Address)
+	if want := scanAddressUTXOs(cs, wallet.Address); !slices.Equal(utxos, want) || len(utxos) != 1 {
+		t.Errorf("indexed utxos = %v, want %v", utxos, want)
+	}
+	want := []AddressTx{
+		{TxID: last.TxData[1].TxID, Height: last.Height, Position: 1},
+		{TxID: sent.TxID, Height: tip.Height, Position: 1},
+		{TxID: received.TxID, Height: tip.Height - 1, Position: 1},
+	}
+	if !slices.Equal(history, want) {
+		t.Errorf("history = %v, want %v", history, want)
+	}
+	if balance, err := cs.AddressBalance(wallet.Address); err != nil || balance != (Balance{Spendable: 5}) {
+		t.Errorf("AddressBalance() = %+v, %v, want 5 spendable", balance, err)
+	}
+
+	t.Run("paging", func(t *testing.T) {
+		tests := []struct {
+			skip, count int
+			want        []AddressTx
+		}{
+			{0, 2, want[:2]},
+			{1, 1, want[1:2]},
+			{1, 5, want[1:]},
+			{3, 1, nil},
+		}
+		for _, tt := range tests {
+			page, err := cs.AddressHistory(wallet.Address, tt.skip, tt.count)
+			if err != nil || !slices.Equal(page, tt.want) {
+				t.Errorf("AddressHistory(%d, %d) = %v, %v, want %v", tt.skip, tt.count, page, err, tt.want)
+			}
+		}
+		if _, err := cs.AddressHistory(wallet.Address, -1, 1); err == nil {
+			t.Error("AddressHistory() accepted a negative skip")
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		if _, err := cs.DisconnectTip(); err != nil {
+			t.Fatal(err)
+		}
+		utxos, history := indexedAddress(t, cs, wallet.Address)
+		if !slices.Equal(utxos, utxosBefore) || !slices.Equal(history, historyBefore) {
+			t.Errorf("index after disconnect = %v, %v, want %v, %v", utxos, history, utxosBefore, historyBefore)
+		}
+		if !slices.Equal(utxos, scanAddressUTXOs(cs, wallet.Address)) {
+			t.Errorf("indexed utxos = %v, want %v", utxos, scanAddressUTXOs(cs, wallet.Address))
+		}
+		if balance, err := cs.AddressBalance(wallet.Address); err != nil || balance != balanceBefore {
+			t.Errorf("AddressBalance() = %+v, %v, want %+v", balance, err, balanceBefore)
+		}
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		addresses := []string{wallet.Address, recipient.Address}
+		incremental := make(map[string][]AddressTx)
+		for _, address := range addresses {
+			_, incremental[address] = indexedAddress(t, cs, address)
+		}
+
+		if err := cs.SetAddrIndex(false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cs.AddressUTXOs(wallet.Address); !errors.Is(err, ErrNoAddrIndex) {
+			t.Fatalf("AddressUTXOs() of disabled index = %v, want %v", err, ErrNoAddrIndex)
+		}
+		if err := cs.SetAddrIndex(true); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, address := range addresses {
+			utxos, history := indexedAddress(t, cs, address)
+			if want := scanAddressUTXOs(cs, address); !slices.Equal(utxos, want) {
+				t.Errorf("rebuilt utxos of %s = %v, want %v", address, utxos, want)
+			}
+			if !slices.Equal(history, incremental[address]) || len(history) == 0 {
+				t.Errorf("rebuilt history of %s = %v, want %v", address, history, incremental[address])
+			}
+		}
+	})
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"strconv"
+	"math/big"
 	"sync"
 	"time"
 
@@ -14,32 +14,40 @@ import (
 
 var log = logger.NewLogger()
 
-type Block struct {
-	Height     uint64        `json:"height"`
-	TxData     []Transaction `json:"transaction_data"`
-	Timestamps string        `json:"timestamps"`
-	Nonce      int           `json:"nonce"`
-	Hash       string        `json:"hash"`
-	PrevHash   string        `json:"prev_hash"`
+// BlockVersion is the version of newly created block headers
+const BlockVersion = 1
+
+// BlockHeader holds the fields of a block committed to by its hash.
+// The transactions are committed to through the merkle root.
+type BlockHeader struct {
+	Version    uint32 `json:"version"`
+	PrevHash   string `json:"prev_hash"`
+	MerkleRoot string `json:"merkle_root"`
+	Timestamp  int64  `json:"timestamp"` // unix time in seconds at which the block was created
+	Bits       uint32 `json:"bits"`      // compact proof-of-work target the block was mined at
+	Nonce      int    `json:"nonce"`
 }
 
-type index map[string]uint64
+type Block struct {
+	BlockHeader `json:"header"`
+	Height      uint64        `json:"height"`
+	TxData      []Transaction `json:"transaction_data"`
+	Hash        string        `json:"hash"`
+}
 
 type Blockchain struct {
-	chain      []*Block
-	blockIndex index
-	difficulty int // Mining Difficulty. In real blockchains, this is adjusted dynamically over time.
-	store      *Store
-	mu         sync.Mutex
+	tip   *blockNode            // tip of the main chain, nil while the chain is empty
+	nodes map[string]*blockNode // block tree of all stored blocks, including side chains, caching their headers
+	store *Store
+	mu    sync.Mutex
 }
 
 // NewBlockchain initializes a Blockchain with the given BoltDB instance.
-// It loads existing blocks from the database and returns the Blockchain.
+// It loads the block tree from the database and returns the Blockchain.
 func NewBlockchain(store *Store, blockBucket string) (*Blockchain, error) {
 	bc := &Blockchain{
-		difficulty: 2, // hard-coded difficulty; actual blockchain adjust difficulty dynamically over-time
-		store:      store,
-		blockIndex: make(index),
+		store: store,
+		nodes: make(map[string]*blockNode),
 	}
 
 	err := bc.Load()
@@ -51,7 +59,8 @@ func NewBlock() *Block {
 	return &Block{}
 }
 
-// Load loads all blocks from the db
+// Load loads the block tree from the headers stored in the db and points the tip to the stored tip.
+// Block bodies are not loaded, they are read from the db when they are needed.
 // Returns error if Db for blockchain is not initialised or if the transactions fails
 func (bc *Blockchain) Load() error {
 	bc.mu.Lock()
@@ -62,68 +71,103 @@ func (bc *Blockchain) Load() error {
 	}
 
 	store := bc.Store()
-	blocks, err := store.LoadBlocksFromTip()
+	if err := store.IndexHeaders(); err != nil {
+		return fmt.Errorf("Error indexing headers of stored blocks: %v\n", err)
+	}
+
+	headers, err := store.LoadHeaders()
+	if err != nil {
+		return fmt.Errorf("Error loading block tree from db: %v\n", err)
+	}
+	invalid, err := store.LoadInvalid()
 	if err != nil {
-		return fmt.Errorf("Error loading blocks from db: %v\n", err)
+		return fmt.Errorf("Error loading invalid blocks from db: %v\n", err)
 	}
+	bc.nodes = buildBlockTree(headers, invalid)
 
-	// Reverse the obtained block slice to get the correct order
-	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
-		blocks[i], blocks[j] = blocks[j], blocks[i]
+	tip, err := store.TipHash()
+	if err != nil {
+		return fmt.Errorf("Error loading tip from db: %v\n", err)
+	}
+	if tip != "" {
+		node, exists := bc.nodes[tip]
+		if !exists {
+			return fmt.Errorf("tip block:[%s] not found in block tree", tip)
+		}
+		bc.tip = node
 	}
 
-	bc.chain = append(bc.chain, blocks...)
+	return nil
+}
 
-	if bc.blockIndex == nil {
-		return errors.New("Cannot update blockchain index. blockchain index is nil")
+// appendBlock makes block the new tip of the in-memory chain, once it was written to the db as the tip
+func (bc *Blockchain) appendBlock(block *Block) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	node, exists := bc.nodes[block.Hash]
+	if !exists {
+		node = newBlockNode(block, bc.nodes[block.PrevHash])
+		bc.nodes[block.Hash] = node
 	}
+	bc.tip = node
+}
 
-	for _, b := range blocks {
-		bc.blockIndex[b.Hash] = b.Height
+// AddSideBlock stores a block that does not extend the tip and adds it to the block tree
+func (bc *Blockchain) AddSideBlock(block *Block) error {
+	if err := bc.Store().StoreBlock(block); err != nil {
+		return err
 	}
 
-	return err
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.nodes[block.Hash] = newBlockNode(block, bc.nodes[block.PrevHash])
+	return nil
 }
 
-// AddBlock add the new block to the blockchain
-func (bc *Blockchain) AddBlock(block *Block) error {
-	err := RetryN(func() error {
-		err := bc.Store().WriteBlock(block)
-		return err
-	}, 3, fmt.Sprintf("Error writing block:[%s] to db", block.Hash))
+// removeTip detaches the tip of the in-memory chain, making its parent the new tip,
+// once the parent was written to the db as the tip
+func (bc *Blockchain) removeTip() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
 
-	// Add block to in-memory chain after successful write of the block to the db
-	if err == nil {
-		bc.mu.Lock()
-		defer bc.mu.Unlock()
-		bc.chain = append(bc.chain, block)
-		bc.blockIndex[block.Hash] = block.Height
+	if bc.tip != nil {
+		bc.tip = bc.tip.parent
 	}
-
-	return err
 }
 
+// NewBlock creates a block template on top of the tip with the given transactions.
+// Only the nonce is left for the miner to fill in.
 func (bc *Blockchain) NewBlock(txs []Transaction) *Block {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+	return newBlock(bc.tipNode(), txs)
+}
 
+// newBlock creates a block template on top of parent, or a genesis block if parent is nil
+func newBlock(parent *blockNode, txs []Transaction) *Block {
 	var blockHeight uint64
 	var pvHash string
 
-	if len(bc.chain) == 0 {
-		blockHeight = 0
-		pvHash = ""
-	} else {
-		blockHeight = bc.chain[len(bc.chain)-1].Height + 1
-		pvHash = bc.chain[len(bc.chain)-1].Hash
+	if parent != nil {
+		blockHeight = parent.height + 1
+		pvHash = parent.hash
 	}
 
 	b := Block{
-		Height:     blockHeight,
-		TxData:     txs,
-		Timestamps: time.Now().String(),
-		PrevHash:   pvHash,
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  pvHash,
+			Timestamp: newBlockTime(parent),
+			Bits:      nextBits(parent),
+		},
+		Height: blockHeight,
+		TxData: txs,
+	}
+
+	merkleRoot, err := b.CalculateMerkleRoot()
+	if err != nil {
+		log.Error("Error calculating merkle root of new block:", err)
 	}
+	b.MerkleRoot = merkleRoot
+
 	return &b
 }
 
@@ -131,61 +175,297 @@ func (bc *Blockchain) Store() *Store {
 	return bc.store
 }
 
-func (bc *Blockchain) Chain() []*Block {
-	return bc.chain
+// Difficulty returns the compact target required for the next block on top of the tip
+func (bc *Blockchain) Difficulty() uint32 {
+	return nextBits(bc.tipNode())
 }
 
-func (bc *Blockchain) Index() index {
-	return bc.blockIndex
+// ChainWork returns the cumulative work of the main chain
+func (bc *Blockchain) ChainWork() *big.Int {
+	tip := bc.tipNode()
+	if tip == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(tip.work)
 }
 
-func (bc *Blockchain) Difficulty() int {
-	return bc.difficulty
+func (bc *Blockchain) GetBlockchainHeight() int {
+	tip := bc.tipNode()
+	if tip == nil {
+		return -1
+	}
+	return int(tip.height)
 }
 
-func (bc *Blockchain) GetBlockchainHeight() int {
+// TipHash returns the hash of the last block of the main chain, or an empty string if the chain is empty
+func (bc *Blockchain) TipHash() string {
+	tip := bc.tipNode()
+	if tip == nil {
+		return ""
+	}
+	return tip.hash
+}
+
+// Tip reads the last block of the main chain from the db. It returns nil if the chain is empty.
+func (bc *Blockchain) Tip() (*Block, error) {
+	tip := bc.tipNode()
+	if tip == nil {
+		return nil, nil
+	}
+	return bc.GetBlock(tip.hash)
+}
+
+// GetBlock returns a stored block with the given hash, whether on the main chain or not
+func (bc *Blockchain) GetBlock(hash string) (*Block, error) {
+	return bc.Store().GetBlock(hash)
+}
+
+// Header returns the cached header of a stored block with the given hash, whether on the main chain or not
+func (bc *Blockchain) Header(hash string) (*BlockHeader, bool) {
+	n := bc.node(hash)
+	if n == nil {
+		return nil, false
+	}
+	header := n.header
+	return &header, true
+}
+
+// MainChainHeight returns the height of the block with the given hash if it is on the main chain
+func (bc *Blockchain) MainChainHeight(hash string) (uint64, bool) {
+	n := bc.node(hash)
+	if n == nil {
+		return 0, false
+	}
+	mainHash, err := bc.Store().GetHashByHeight(n.height)
+	if err != nil || mainHash != hash {
+		return 0, false
+	}
+	return n.height, true
+}
+
+// BlockLocator returns the hashes of a sparse list of blocks leading from the block with the given hash,
+// or from the tip if hash is empty, back to the genesis block: the last 10 blocks, then blocks at
+// exponentially growing distances. A peer finds the fork point of its main chain from the locator.
+func (bc *Blockchain) BlockLocator(hash string) []string {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	chainLen := len(bc.chain)
-	if chainLen == 0 {
-		return -1
+
+	n := bc.tip
+	if hash != "" {
+		n = bc.nodes[hash]
+	}
+
+	var locator []string
+	step := uint64(1)
+	for n != nil {
+		locator = append(locator, n.hash)
+		if n.height == 0 {
+			break
+		}
+		if len(locator) >= 10 {
+			step *= 2
+		}
+		n = n.ancestor(n.height - min(step, n.height))
+	}
+	return locator
+}
+
+// FindFork returns the height of the first block of locator on the main chain, the last block
+// the main chain has in common with the chain the locator was built from
+func (bc *Blockchain) FindFork(locator []string) (uint64, bool) {
+	for _, hash := range locator {
+		if height, ok := bc.MainChainHeight(hash); ok {
+			return height, true
+		}
+	}
+	return 0, false
+}
+
+// GetBlockByHeight reads the block of the main chain at height from the db
+func (bc *Blockchain) GetBlockByHeight(height uint64) (*Block, error) {
+	hash, err := bc.Store().GetHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return bc.GetBlock(hash)
+}
+
+// ForEachBlock calls fn with the blocks of the main chain from height from up to the current tip,
+// see ForEachBlockInRange
+func (bc *Blockchain) ForEachBlock(from uint64, fn func(*Block) error) error {
+	tip := bc.tipNode()
+	if tip == nil {
+		return nil
 	}
-	return int(bc.chain[chainLen-1].Height)
+	return bc.ForEachBlockInRange(from, tip.height, fn)
 }
-func (bc *Blockchain) IsValid(b *Block) bool {
+
+// ForEachBlockInRange calls fn with the blocks of the main chain from height from through height to,
+// oldest first, reading one block at a time from the db. It stops at the first error returned by fn.
+// If the main chain is reorganized meanwhile, it fails rather than mixing blocks of both chains.
+func (bc *Blockchain) ForEachBlockInRange(from, to uint64, fn func(*Block) error) error {
+	var prevHash string
+	for height := from; height <= to; height++ {
+		b, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		if height > from && b.PrevHash != prevHash {
+			return fmt.Errorf("main chain changed at height %d while reading it", height)
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+		prevHash = b.Hash
+	}
+	return nil
+}
+
+// checkBlock validates block b against its parent in the block tree.
+// It returns the parent node, which is nil for a genesis block.
+func (bc *Blockchain) checkBlock(b *Block) (*blockNode, error) {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	if len(bc.chain) > 0 {
-		latestBlock := bc.chain[len(bc.chain)-1]
-		if latestBlock.Height+1 != b.Height {
-			log.Error("Block validation failed: invalid block height")
-			return false
+
+	if _, exists := bc.nodes[b.Hash]; exists {
+		return nil, ErrBlockKnown
+	}
+
+	var parent *blockNode
+	if b.PrevHash != "" {
+		p, exists := bc.nodes[b.PrevHash]
+		if !exists {
+			return nil, ErrOrphanBlock
 		}
-		if latestBlock.Hash != b.PrevHash {
-			log.Error("Block validation failed: previous block hash not matched")
-			return false
+		if p.invalid {
+			return nil, ErrInvalidParent
 		}
+		parent = p
+	}
+
+	if parent == nil && b.Height != 0 || parent != nil && parent.height+1 != b.Height {
+		return nil, ErrInvalidBlockHeight
+	}
+	if len(b.Serialize()) > MaxBlockSize {
+		return nil, ErrBlockTooLarge
+	}
+	if parent != nil && b.Timestamp <= parent.medianTimePast() {
+		return nil, fmt.Errorf("%w: not after the median time of the last %d blocks", ErrInvalidTimestamp, MedianTimeBlocks)
+	}
+	if b.Timestamp > time.Now().Add(MaxFutureBlockTime).Unix() {
+		return nil, fmt.Errorf("%w: more than %v in the future", ErrInvalidTimestamp, MaxFutureBlockTime)
+	}
+	if err := b.checkMerkleRoot(); err != nil {
+		return nil, err
+	}
+	if b.Bits != nextBits(parent) {
+		return nil, ErrInvalidDifficulty
 	}
 	if !b.validateHash() {
-		log.Error("Block validation failed: invalid hash")
-		return false
+		return nil, ErrInvalidBlockHash
 	}
 
-	return true
+	return parent, nil
 }
 
+// checkMerkleRoot checks that the header of b commits to its transactions. Transactions must be
+// unique and the merkle tree must not be mutated, so that no other list of transactions has the same root.
+// A body failing this check does not belong to the header, which says nothing about the block itself.
+func (b *Block) checkMerkleRoot() error {
+	seen := make(map[string]bool, len(b.TxData))
+	for _, tx := range b.TxData {
+		if seen[tx.TxID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateTx, tx.TxID)
+		}
+		seen[tx.TxID] = true
+	}
+
+	merkleRoot, err := b.CalculateMerkleRoot()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMerkleRoot, err)
+	}
+	if merkleRoot != b.MerkleRoot {
+		return ErrInvalidMerkleRoot
+	}
+	return nil
+}
+
+// tipNode returns the block tree node of the main chain tip
+func (bc *Blockchain) tipNode() *blockNode {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.tip
+}
+
+func (bc *Blockchain) node(hash string) *blockNode {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.nodes[hash]
+}
+
+// markInvalid records the block with the given hash as invalid in the db and marks it invalid in the
+// block tree along with every block descending from it, so that no branch building on it is connected again
+func (bc *Blockchain) markInvalid(hash string) error {
+	if err := bc.Store().WriteInvalid(hash); err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	failed, exists := bc.nodes[hash]
+	if !exists {
+		return nil
+	}
+	failed.invalid = true
+	for _, n := range bc.nodes {
+		if n.height > failed.height && n.ancestor(failed.height) == failed {
+			n.invalid = true
+		}
+	}
+	return nil
+}
+
+// Time returns the timestamp of the block
+func (b *Block) Time() time.Time {
+	return time.Unix(b.Timestamp, 0)
+}
+
+// newBlockTime returns the timestamp for a new block on top of parent: the current time,
+// moved past the median time of the previous blocks if the clock is behind it
+func newBlockTime(parent *blockNode) int64 {
+	now := time.Now().Unix()
+	if parent != nil && now <= parent.medianTimePast() {
+		return parent.medianTimePast() + 1
+	}
+	return now
+}
+
+// MedianTimePast returns the median timestamp of the last MedianTimeBlocks blocks of the main chain,
+// which the timestamp of the next block must exceed. It is zero for an empty chain.
+func (bc *Blockchain) MedianTimePast() int64 {
+	tip := bc.tipNode()
+	if tip == nil {
+		return 0
+	}
+	return tip.medianTimePast()
+}
+
+// validateHash checks that the block hash is correctly computed and meets the target of the block
 func (b *Block) validateHash() bool {
 	h := b.calculateHash()
 	if h != b.Hash {
 		return false
 	}
-	return true
+	return meetsTarget(h, b.Bits)
 }
 
 func (b *Block) calculateHash() string {
-	data := strconv.FormatUint(b.Height, 10) + TransactionsToString(b.TxData) + b.Timestamps + strconv.Itoa(b.Nonce) + b.PrevHash
+	return b.BlockHeader.calculateHash()
+}
 
-	hash := sha256.Sum256([]byte(data))
+// calculateHash hashes the canonical encoding of the header, identifying the block without its transactions
+func (h *BlockHeader) calculateHash() string {
+	hash := sha256.Sum256(h.Serialize())
 
 	return hex.EncodeToString(hash[:])
 }
@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBlockLocator(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, 30)
+	bc := cs.Blockchain()
+
+	var want []string
+	for _, height := range []uint64{29, 28, 27, 26, 25, 24, 23, 22, 21, 20, 18, 14, 6, 0} {
+		b, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, b.Hash)
+	}
+	if got := bc.BlockLocator(""); !slices.Equal(got, want) {
+		t.Errorf("BlockLocator(tip) = %v, want %v", got, want)
+	}
+	if got := bc.BlockLocator(tip.Hash); !slices.Equal(got, want) {
+		t.Errorf("BlockLocator(%s) = %v, want %v", tip.Hash, got, want)
+	}
+	if got := bc.BlockLocator("unknown"); len(got) != 0 {
+		t.Errorf("BlockLocator(unknown) = %v, want none", got)
+	}
+}
+
+func TestFindFork(t *testing.T) {
+	cs := newTestChainState(t)
+	fork := extendTestChain(t, cs, nil, 15)
+	extendTestChain(t, cs, fork, 3)
+
+	// a lighter branch off the main chain at the fork
+	side := fork
+	for range 2 {
+		side = newTestChainBlock(t, cs, side, 20)
+		if _, err := cs.ProcessBlock(side); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bc := cs.Blockchain()
+	tests := []struct {
+		name    string
+		locator []string
+		want    uint64
+		found   bool
+	}{
+		{"main chain tip", bc.BlockLocator(""), uint64(bc.GetBlockchainHeight()), true},
+		{"side chain", bc.BlockLocator(side.Hash), fork.Height, true},
+		{"unknown blocks", []string{"aa", "bb"}, 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			height, found := bc.FindFork(tt.locator)
+			if height != tt.want || found != tt.found {
+				t.Errorf("FindFork = %d, %v, want %d, %v", height, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestCheckBlockTimestamp(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, MedianTimeBlocks)
+	bc := cs.Blockchain()
+	medianTime := bc.MedianTimePast()
+	maxDrift := int64(MaxFutureBlockTime / time.Second)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		fromNow   bool // whether timestamp is relative to the current time
+		err       error
+	}{
+		{"before median time", medianTime - 1, false, ErrInvalidTimestamp},
+		{"equal to median time", medianTime, false, ErrInvalidTimestamp},
+		{"after median time", medianTime + 1, false, nil},
+		{"before the parent", tip.Timestamp - 1, false, nil},
+		{"maximum future drift", maxDrift, true, nil},
+		{"past maximum future drift", maxDrift + 1, true, ErrInvalidTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the clock must not move on between timestamping the block and checking it
+			for {
+				now := time.Now().Unix()
+				timestamp := tt.timestamp
+				if tt.fromNow {
+					timestamp += now
+				}
+				b := newTestChainBlock(t, cs, tip, timestamp-tip.Timestamp)
+				_, err := bc.checkBlock(b)
+				if time.Now().Unix() != now {
+					continue
+				}
+				if !errors.Is(err, tt.err) {
+					t.Errorf("checkBlock() = %v, want %v", err, tt.err)
+				}
+				return
+			}
+		})
+	}
+}
+
+func TestNewBlockTime(t *testing.T) {
+	// chain whose blocks are timestamped offset seconds from now
+	chain := func(offset int64) *blockNode {
+		var tip *blockNode
+		for i := range MedianTimeBlocks {
+			b := &Block{BlockHeader: BlockHeader{Timestamp: time.Now().Unix() + offset}, Height: uint64(i)}
+			tip = newBlockNode(b, tip)
+		}
+		return tip
+	}
+	ahead := chain(3600)
+
+	tests := []struct {
+		name   string
+		parent *blockNode
+		clamp  bool // whether the time is clamped to one second past the median time of parent
+	}{
+		{"genesis", nil, false},
+		{"median time behind the clock", chain(-3600), false},
+		{"median time ahead of the clock", ahead, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().Unix()
+			got := newBlockTime(tt.parent)
+			after := time.Now().Unix()
+
+			if tt.clamp {
+				if want := ahead.medianTimePast() + 1; got != want {
+					t.Errorf("newBlockTime() = %d, want %d", got, want)
+				}
+			} else if got < before || got > after {
+				t.Errorf("newBlockTime() = %d, want the current time", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"math/big"
+	"slices"
+	"sort"
+)
+
+// blockNode is an entry of the block tree. Every stored block, on the main chain
+// or on a side chain, has a node linking it to its parent and caching its header.
+type blockNode struct {
+	header    BlockHeader
+	hash      string
+	height    uint64
+	timestamp int64  // unix time in seconds
+	bits      uint32 // compact target the block was required to meet
+	parent    *blockNode
+	work      *big.Int // cumulative work of the chain ending at this block
+	invalid   bool     // set when the block, or one of its ancestors, failed validation while connecting it
+}
+
+// newBlockNode creates the block tree node for block b
+func newBlockNode(b *Block, parent *blockNode) *blockNode {
+	work := CalcWork(b.Bits)
+	if parent != nil {
+		work.Add(work, parent.work)
+	}
+
+	return &blockNode{
+		header:    b.BlockHeader,
+		hash:      b.Hash,
+		height:    b.Height,
+		timestamp: b.Timestamp,
+		bits:      b.Bits,
+		parent:    parent,
+		work:      work,
+	}
+}
+
+// ancestor returns the ancestor of n at the given height, or nil if there is none
+func (n *blockNode) ancestor(height uint64) *blockNode {
+	if height > n.height {
+		return nil
+	}
+	for n != nil && n.height > height {
+		n = n.parent
+	}
+	return n
+}
+
+// medianTimePast returns the median timestamp of n and its ancestors, up to MedianTimeBlocks blocks
+func (n *blockNode) medianTimePast() int64 {
+	timestamps := make([]int64, 0, MedianTimeBlocks)
+	for i := 0; i < MedianTimeBlocks && n != nil; i++ {
+		timestamps = append(timestamps, n.timestamp)
+		n = n.parent
+	}
+	slices.Sort(timestamps)
+	return timestamps[len(timestamps)/2]
+}
+
+// findFork returns the last common ancestor of nodes a and b, or nil
+// if they do not share a genesis block
+func findFork(a, b *blockNode) *blockNode {
+	for a != nil && b != nil && a.height > b.height {
+		a = a.parent
+	}
+	for a != nil && b != nil && b.height > a.height {
+		b = b.parent
+	}
+	for a != nil && b != nil && a != b {
+		a = a.parent
+		b = b.parent
+	}
+	if a == nil || b == nil {
+		return nil
+	}
+	return a
+}
+
+// buildBlockTree links the given blocks, which need not carry their transactions, into block nodes
+// keyed by hash. Blocks whose parent is missing are skipped. The blocks in invalid, and their descendants,
+// are marked invalid.
+func buildBlockTree(blocks []*Block, invalid map[string]bool) map[string]*blockNode {
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+
+	nodes := make(map[string]*blockNode, len(blocks))
+	for _, b := range blocks {
+		var parent *blockNode
+		if b.PrevHash != "" {
+			p, exists := nodes[b.PrevHash]
+			if !exists {
+				log.Warnf("Skipping stored block:[%d]:[%s]: parent not found\n", b.Height, b.Hash)
+				continue
+			}
+			parent = p
+		}
+		node := newBlockNode(b, parent)
+		node.invalid = invalid[b.Hash] || parent != nil && parent.invalid
+		nodes[b.Hash] = node
+	}
+
+	return nodes
+}
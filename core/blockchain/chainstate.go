@@ -1,11 +1,16 @@
 package blockchain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
 
 type ChainState struct {
 	blockchain *Blockchain
 	utxoSet    *UTXOSet
 	mempool    *Mempool
+	mu         sync.Mutex // serialises changes to the main chain
 }
 
 func NewChainState(bc *Blockchain, us *UTXOSet, mem *Mempool) (*ChainState, error) {
@@ -35,3 +40,265 @@ func (cs *ChainState) UTXOSet() *UTXOSet {
 func (cs *ChainState) Mempool() *Mempool {
 	return cs.mempool
 }
+
+// AcceptTx validates tx against the utxo set and adds it to the mempool along with the fee it pays.
+// Transactions spending an output that a mempool transaction already spends are rejected.
+func (cs *ChainState) AcceptTx(tx *Transaction) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.acceptTx(tx)
+}
+
+func (cs *ChainState) acceptTx(tx *Transaction) error {
+	if cs.mempool.HasTx(tx.TxID) {
+		return nil
+	}
+
+	fee, err := cs.utxoSet.checkTransaction(tx, cs.blockchain.tipNode())
+	if err != nil {
+		return &TxValidationError{TxID: tx.TxID, Err: err}
+	}
+
+	if err := cs.mempool.AddTx(tx, fee); err != nil {
+		return &TxValidationError{TxID: tx.TxID, Err: err}
+	}
+	return nil
+}
+
+// TxOutSetInfo returns statistics of the utxo set at the current tip
+func (cs *ChainState) TxOutSetInfo() TxOutSetInfo {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	info := cs.utxoSet.Info()
+	info.Height = cs.blockchain.GetBlockchainHeight()
+	info.BestBlock = cs.blockchain.TipHash()
+	info.TotalIssued = TotalIssued(uint64(info.Height + 1))
+	return info
+}
+
+// Balance returns the balance of address, reporting coinbase outputs that cannot be spent
+// by the next block separately
+func (cs *ChainState) Balance(address string) Balance {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	height := uint64(cs.blockchain.GetBlockchainHeight() + 1)
+	return cs.utxoSet.GetBalanceByAddress(address, height)
+}
+
+// SpendableUTXOs returns the utxos of address that the next block can spend
+func (cs *ChainState) SpendableUTXOs(address string) []UTXO {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	height := uint64(cs.blockchain.GetBlockchainHeight() + 1)
+	return cs.utxoSet.GetSpendableUTXOS(address, height)
+}
+
+// ProcessBlock validates block b and adds it to the block tree.
+// A block extending the tip is connected to the main chain right away. A block on a side chain
+// is stored, and if its branch has more cumulative work than the main chain the node reorganizes
+// onto it. The returned ReorgEvent is non-nil only when the main chain was switched.
+func (cs *ChainState) ProcessBlock(b *Block) (*ReorgEvent, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	bc := cs.blockchain
+	parent, err := bc.checkBlock(b)
+	if err != nil {
+		return nil, fmt.Errorf("block:[%d]:[%s] rejected: %w", b.Height, b.Hash, err)
+	}
+
+	tip := bc.tipNode()
+	if tip == parent {
+		if err := cs.connectBlock(b); err != nil {
+			return nil, fmt.Errorf("block:[%d]:[%s] rejected: %w", b.Height, b.Hash, err)
+		}
+		return nil, nil
+	}
+
+	if err := bc.AddSideBlock(b); err != nil {
+		return nil, err
+	}
+
+	node := bc.node(b.Hash)
+	if tip != nil && node.work.Cmp(tip.work) <= 0 {
+		log.Infof("Block:[%d]:[%s] stored on a side chain\n", b.Height, b.Hash)
+		return nil, nil
+	}
+
+	return cs.reorganize(tip, node)
+}
+
+// connectBlock validates the transactions of b against the utxo set and appends b to the main chain.
+// b must extend the current tip.
+func (cs *ChainState) connectBlock(b *Block) error {
+	if err := cs.utxoSet.validateBlockTxs(b, cs.blockchain.tipNode()); err != nil {
+		return err
+	}
+	spent, err := spentUTXOs(b, cs.utxoSet.lookupUTXO)
+	if err != nil {
+		return err
+	}
+
+	addrIndex := cs.utxoSet.addrIndex
+	err = RetryN(func() error {
+		return cs.utxoSet.Store().ConnectBlock(b, spent, addrIndex)
+	}, 3, fmt.Sprintf("Error writing block:[%s] to db", b.Hash))
+	if err != nil {
+		return err
+	}
+
+	// the block is committed to the db, so the in-memory state can follow
+	cs.blockchain.appendBlock(b)
+	cs.utxoSet.apply(b.TxData, b.Height)
+
+	// evict the transactions of the mempool double spending the outputs the block spent
+	for i := range b.TxData {
+		tx := &b.TxData[i]
+		if tx.IsCoinbase {
+			continue
+		}
+		if cs.mempool.HasTx(tx.TxID) {
+			cs.mempool.RemoveTx(tx.TxID)
+		}
+		for _, txID := range cs.mempool.RemoveConflicts(tx) {
+			log.Infof("Evicted transaction:[%s] from mempool: conflicts with transaction:[%s] of block:[%s]\n", txID, tx.TxID, b.Hash)
+		}
+	}
+	return nil
+}
+
+// DisconnectTip removes the tip of the main chain, restoring the utxo set from the undo record of the tip.
+// Transactions of the removed block are returned to the mempool, and mempool transactions that are
+// no longer valid on the parent are evicted. The removed block is returned.
+func (cs *ChainState) DisconnectTip() (*Block, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	b, err := cs.disconnectTip()
+	if err != nil {
+		return nil, err
+	}
+	cs.revalidateMempool()
+	return b, nil
+}
+
+func (cs *ChainState) disconnectTip() (*Block, error) {
+	tip, err := cs.blockchain.Tip()
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, errors.New("Cannot disconnect tip of an empty chain")
+	}
+
+	undo, err := cs.blockUndo(tip)
+	if err != nil {
+		return nil, err
+	}
+
+	addrIndex := cs.utxoSet.addrIndex
+	err = RetryN(func() error {
+		return cs.utxoSet.Store().DisconnectBlock(tip, undo, addrIndex)
+	}, 3, fmt.Sprintf("Error disconnecting block:[%s] in db", tip.Hash))
+	if err != nil {
+		return nil, err
+	}
+
+	// the parent is committed as the tip, so the in-memory state can follow
+	if err := cs.utxoSet.undo(tip, undo); err != nil {
+		return nil, err
+	}
+	cs.blockchain.removeTip()
+
+	for i := range tip.TxData {
+		if !tip.TxData[i].IsCoinbase {
+			tx := tip.TxData[i]
+			if err := cs.acceptTx(&tx); err != nil {
+				log.Warnf("Dropping transaction of disconnected block:[%s]: %v\n", tip.Hash, err)
+			}
+		}
+	}
+	return tip, nil
+}
+
+// reorganize switches the main chain from oldTip to the branch ending at newTip.
+// Blocks are disconnected back to the fork point, then the new branch is connected.
+// If a block of the new branch fails validation, it is marked invalid along with its descendants, and the
+// old chain is restored.
+// Blocks that could not be read or written are not marked invalid, the old chain is restored all the same.
+// Either way the mempool is re-validated against the resulting tip.
+func (cs *ChainState) reorganize(oldTip, newTip *blockNode) (*ReorgEvent, error) {
+	defer cs.revalidateMempool()
+
+	fork := findFork(oldTip, newTip)
+
+	var attach []*blockNode
+	for n := newTip; n != fork; n = n.parent {
+		attach = append([]*blockNode{n}, attach...)
+	}
+
+	event := &ReorgEvent{}
+	var detached []*Block
+	for n := oldTip; n != fork; n = n.parent {
+		b, err := cs.disconnectTip()
+		if err != nil {
+			return nil, fmt.Errorf("Error disconnecting block:[%s] during reorg: %w", n.hash, err)
+		}
+		detached = append(detached, b)
+		event.Disconnected = append(event.Disconnected, b.Hash)
+	}
+
+	for _, n := range attach {
+		b, err := cs.blockchain.GetBlock(n.hash)
+		if err == nil {
+			err = cs.connectBlock(b)
+		}
+		if err != nil {
+			if isBlockRuleError(err) {
+				if markErr := cs.blockchain.markInvalid(n.hash); markErr != nil {
+					log.Warnf("Error recording block:[%s] as invalid: %v\n", n.hash, markErr)
+				}
+			}
+			if restoreErr := cs.restoreChain(len(event.Connected), detached); restoreErr != nil {
+				return nil, fmt.Errorf("Error restoring chain after failed reorg: %v", restoreErr)
+			}
+			return nil, fmt.Errorf("block:[%d]:[%s] rejected during reorg: %w", n.height, n.hash, err)
+		}
+		event.Connected = append(event.Connected, b.Hash)
+	}
+
+	log.Infof("Chain reorganized: %d block(s) disconnected, %d block(s) connected\n", len(event.Disconnected), len(event.Connected))
+	return event, nil
+}
+
+// revalidateMempool checks every mempool transaction against the utxo set at the tip and evicts those
+// that fail, such as transactions spending outputs of a disconnected block or no longer final at the new height
+func (cs *ChainState) revalidateMempool() {
+	tip := cs.blockchain.tipNode()
+	for _, entry := range cs.mempool.EntriesByFeeRate() {
+		if _, err := cs.utxoSet.checkTransaction(entry.Tx, tip); err != nil {
+			cs.mempool.RemoveTx(entry.Tx.TxID)
+			log.Infof("Evicted transaction:[%s] from mempool: %v\n", entry.Tx.TxID, err)
+		}
+	}
+}
+
+// restoreChain undoes a partial reorg by disconnecting the connected new blocks
+// and reconnecting the detached blocks, given from the old tip down to the fork point
+func (cs *ChainState) restoreChain(connected int, detached []*Block) error {
+	for i := 0; i < connected; i++ {
+		if _, err := cs.disconnectTip(); err != nil {
+			return err
+		}
+	}
+	for i := len(detached) - 1; i >= 0; i-- {
+		if err := cs.connectBlock(detached[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package blockchain
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// newTestChainState creates an empty chain state backed by a db under a temporary home directory
+func newTestChainState(t *testing.T) *ChainState {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	store, err := NewDb("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Db().Close() })
+
+	for _, create := range []func() error{
+		store.CreateBlocksBucket, store.CreateUTXOSetBucket, store.CreateTxIndexBucket,
+		store.CreateUndoBucket, store.CreateHeaderBuckets, store.CreateDataIndexBucket,
+	} {
+		if err := create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bc, err := NewBlockchain(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := NewUTXOSet(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := NewChainState(bc, us, NewMempool())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+// newTestChainBlock mines a block on top of parent, or a genesis block if parent is nil, holding txs after
+// a coinbase paying the subsidy to anyone. The block is timestamped spacing seconds after its parent, which
+// also sets apart the coinbases of competing blocks at the same height.
+func newTestChainBlock(t *testing.T, cs *ChainState, parent *Block, spacing int64, txs ...Transaction) *Block {
+	t.Helper()
+	b := &Block{BlockHeader: BlockHeader{Version: BlockVersion, Timestamp: 1700000000, Bits: InitialBits}}
+	if parent != nil {
+		b.PrevHash = parent.Hash
+		b.Height = parent.Height + 1
+		b.Timestamp = parent.Timestamp + spacing
+		b.Bits = nextBits(cs.Blockchain().node(parent.Hash))
+	}
+
+	coinbase := newTestCoinbase(b.Height, Subsidy(b.Height))
+	coinbase.Timestamp = b.Timestamp
+	coinbase.TxID = coinbase.calculateID()
+	b.TxData = append([]Transaction{*coinbase}, txs...)
+
+	merkleRoot, err := b.CalculateMerkleRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.MerkleRoot = merkleRoot
+	for b.Hash = b.calculateHash(); !meetsTarget(b.Hash, b.Bits); b.Hash = b.calculateHash() {
+		b.Nonce++
+	}
+	return b
+}
+
+// extendTestChain connects n blocks on top of the tip of cs, returning the new tip
+func extendTestChain(t *testing.T, cs *ChainState, tip *Block, n int) *Block {
+	t.Helper()
+	for range n {
+		tip = newTestChainBlock(t, cs, tip, 30)
+		if _, err := cs.ProcessBlock(tip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tip
+}
+
+// snapshotUTXOs returns a copy of the utxo set of cs
+func snapshotUTXOs(cs *ChainState) UTXOMap {
+	snapshot := make(UTXOMap)
+	for txID, utxos := range cs.UTXOSet().UTXOs {
+		snapshot[txID] = maps.Clone(utxos)
+	}
+	return snapshot
+}
+
+func equalUTXOs(a, b UTXOMap) bool {
+	return maps.EqualFunc(a, b, func(x, y map[int]UTXO) bool { return maps.Equal(x, y) })
+}
+
+func TestReorgToHeavierBranch(t *testing.T) {
+	cs := newTestChainState(t)
+	// the genesis coinbase matures at the height of the fork
+	base := extendTestChain(t, cs, nil, CoinbaseMaturity)
+	genesis, err := cs.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atFork := snapshotUTXOs(cs)
+
+	spend := newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0)-1)
+	a1 := newTestChainBlock(t, cs, base, 30, *spend)
+	if event, err := cs.ProcessBlock(a1); err != nil || event != nil {
+		t.Fatalf("ProcessBlock(a1) = %v, %v", event, err)
+	}
+
+	b1 := newTestChainBlock(t, cs, base, 20)
+	if event, err := cs.ProcessBlock(b1); err != nil || event != nil {
+		t.Fatalf("ProcessBlock(b1) = %v, %v, want the block on a side chain", event, err)
+	}
+	if cs.Blockchain().TipHash() != a1.Hash {
+		t.Fatalf("tip = %s, want a1 %s", cs.Blockchain().TipHash(), a1.Hash)
+	}
+
+	b2 := newTestChainBlock(t, cs, b1, 20)
+	event, err := cs.ProcessBlock(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event == nil || !slices.Equal(event.Disconnected, []string{a1.Hash}) ||
+		!slices.Equal(event.Connected, []string{b1.Hash, b2.Hash}) {
+		t.Fatalf("reorg event = %+v, want a1 disconnected, b1 and b2 connected", event)
+	}
+
+	bc := cs.Blockchain()
+	if bc.TipHash() != b2.Hash || bc.GetBlockchainHeight() != int(b2.Height) {
+		t.Fatalf("tip = %s at height %d, want b2 %s", bc.TipHash(), bc.GetBlockchainHeight(), b2.Hash)
+	}
+	if hash, err := bc.Store().GetHashByHeight(a1.Height); err != nil || hash != b1.Hash {
+		t.Errorf("main chain block at height %d = %s, %v, want b1", a1.Height, hash, err)
+	}
+
+	// the spend of a1 is back in the mempool, and its input unspent again
+	if !cs.Mempool().HasTx(spend.TxID) {
+		t.Error("transaction of the disconnected block not returned to the mempool")
+	}
+	if _, err := cs.Blockchain().Store().GetTxLocation(spend.TxID); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("transaction of the disconnected block still indexed: %v", err)
+	}
+	want := atFork
+	for _, b := range []*Block{b1, b2} {
+		want[b.TxData[0].TxID] = map[int]UTXO{0: b.TxData[0].OutputUTXO(0, b.Height)}
+	}
+	if got := snapshotUTXOs(cs); !equalUTXOs(got, want) {
+		t.Errorf("utxo set after reorg = %v, want %v", got, want)
+	}
+
+	// the reorged state is the one the db holds
+	reloaded, err := NewUTXOSet(bc.Store(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalUTXOs(reloaded.UTXOs, want) {
+		t.Errorf("utxo set loaded from db = %v, want %v", reloaded.UTXOs, want)
+	}
+}
+
+func TestReorgToInvalidBranch(t *testing.T) {
+	cs := newTestChainState(t)
+	base := extendTestChain(t, cs, nil, 2)
+	a2 := extendTestChain(t, cs, base, 2)
+	before := snapshotUTXOs(cs)
+
+	// b2 spends an output that does not exist, which is only found when the branch is connected
+	missing := newTestTx([]string{newTestCoinbase(99, 1).TxID}, 1)
+	b1 := newTestChainBlock(t, cs, base, 20)
+	b2 := newTestChainBlock(t, cs, b1, 20, *missing)
+	for _, b := range []*Block{b1, b2} {
+		if event, err := cs.ProcessBlock(b); err != nil || event != nil {
+			t.Fatalf("ProcessBlock(%d) = %v, %v, want the block on a side chain", b.Height, event, err)
+		}
+	}
+	b3 := newTestChainBlock(t, cs, b2, 20)
+	event, err := cs.ProcessBlock(b3)
+	var txErr *TxValidationError
+	if event != nil || !errors.As(err, &txErr) {
+		t.Fatalf("ProcessBlock(b3) = %v, %v, want a transaction validation error", event, err)
+	}
+
+	bc := cs.Blockchain()
+	if bc.TipHash() != a2.Hash {
+		t.Fatalf("tip = %s, want the old tip a2 %s", bc.TipHash(), a2.Hash)
+	}
+	if got := snapshotUTXOs(cs); !equalUTXOs(got, before) {
+		t.Errorf("utxo set after failed reorg = %v, want %v", got, before)
+	}
+	if bc.node(b1.Hash).invalid || !bc.node(b2.Hash).invalid || !bc.node(b3.Hash).invalid {
+		t.Error("want b2 and its child b3 marked invalid and b1 left valid")
+	}
+
+	// extending the invalid branch is rejected before any reorg is attempted
+	b4 := newTestChainBlock(t, cs, b3, 20)
+	if event, err := cs.ProcessBlock(b4); event != nil || !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("ProcessBlock(grandchild of invalid block) = %v, %v, want %v", event, err, ErrInvalidParent)
+	}
+	if bc.TipHash() != a2.Hash {
+		t.Errorf("tip = %s, want the old tip a2 %s", bc.TipHash(), a2.Hash)
+	}
+
+	// the invalid branch stays invalid once the block tree is loaded again
+	reloaded, err := NewBlockchain(bc.Store(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.node(b1.Hash).invalid || !reloaded.node(b2.Hash).invalid || !reloaded.node(b3.Hash).invalid {
+		t.Error("want b2 and b3 loaded as invalid and b1 as valid")
+	}
+}
+
+func TestMempoolRevalidation(t *testing.T) {
+	// setup connects a block spending the genesis coinbase in tx and fills the mempool with child,
+	// spending the output of tx, and locked, final only from the block after that block
+	setup := func(t *testing.T) (cs *ChainState, fork, tip *Block, tx, child, locked *Transaction) {
+		cs = newTestChainState(t)
+		fork = extendTestChain(t, cs, nil, CoinbaseMaturity+2)
+		bc := cs.Blockchain()
+		genesis, err := bc.GetBlockByHeight(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, err := bc.GetBlockByHeight(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx = newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0))
+		tip = newTestChainBlock(t, cs, fork, 30, *tx)
+		if _, err := cs.ProcessBlock(tip); err != nil {
+			t.Fatal(err)
+		}
+
+		child = newTestTx([]string{tx.TxID}, Subsidy(0))
+		locked = newTestTx([]string{first.TxData[0].TxID}, Subsidy(1))
+		locked.LockTime = uint32(tip.Height)
+		locked.Inputs[0].Sequence = 0
+		locked.TxID = locked.calculateID()
+		for _, mempoolTx := range []*Transaction{child, locked} {
+			if err := cs.AcceptTx(mempoolTx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return cs, fork, tip, tx, child, locked
+	}
+
+	t.Run("disconnect", func(t *testing.T) {
+		cs, _, _, tx, child, locked := setup(t)
+		if _, err := cs.DisconnectTip(); err != nil {
+			t.Fatal(err)
+		}
+
+		mempool := cs.Mempool()
+		if !mempool.HasTx(tx.TxID) {
+			t.Error("transaction of the disconnected block not returned to the mempool")
+		}
+		if mempool.HasTx(child.TxID) {
+			t.Error("transaction spending an output of the disconnected block kept in the mempool")
+		}
+		if mempool.HasTx(locked.TxID) {
+			t.Error("non-final transaction kept in the mempool")
+		}
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		cs, fork, _, tx, child, locked := setup(t)
+
+		// the side branch spends the genesis coinbase in another transaction
+		genesis, err := cs.Blockchain().GetBlockByHeight(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		double := newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0)-1)
+		side := newTestChainBlock(t, cs, fork, 31, *double)
+		if _, err := cs.ProcessBlock(side); err != nil {
+			t.Fatal(err)
+		}
+		side = newTestChainBlock(t, cs, side, 30)
+		event, err := cs.ProcessBlock(side)
+		if err != nil || event == nil {
+			t.Fatalf("ProcessBlock() = %v, %v, want a reorg", event, err)
+		}
+
+		mempool := cs.Mempool()
+		for _, evicted := range []*Transaction{tx, child} {
+			if mempool.HasTx(evicted.TxID) {
+				t.Errorf("transaction:[%s] kept in the mempool after the reorg", evicted.TxID)
+			}
+		}
+		// the new branch is as high as the old one, so locked is still final
+		if !mempool.HasTx(locked.TxID) {
+			t.Error("final transaction evicted from the mempool")
+		}
+	})
+}
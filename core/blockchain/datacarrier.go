@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// DataRecord locates a data carrier output on the main chain
+type DataRecord struct {
+	Data        string `json:"data"` // hex encoded payload
+	TxID        string `json:"transaction_id"`
+	OutputIndex int    `json:"output_index"`
+	BlockHash   string `json:"block_hash"`
+	Height      uint64 `json:"height"`
+}
+
+// DataRecords returns the data carrier outputs of the transactions of the block
+func (b *Block) DataRecords() []DataRecord {
+	var records []DataRecord
+	for _, tx := range b.TxData {
+		for index, output := range tx.Outputs {
+			data, ok := output.Data()
+			if !ok {
+				continue
+			}
+			records = append(records, DataRecord{
+				Data:        hex.EncodeToString(data),
+				TxID:        tx.TxID,
+				OutputIndex: index,
+				BlockHash:   b.Hash,
+				Height:      b.Height,
+			})
+		}
+	}
+	return records
+}
+
+// CreateDataTransaction creates a transaction anchoring data in a data carrier output.
+// The fee is paid from the outputs of the wallet selected from utxoSet, and every input is
+// signed with the wallet key. See fundTransaction for fee and feeRate.
+func (wallet *Wallet) CreateDataTransaction(utxoSet UTXOSource, data []byte, fee, feeRate int) (*Transaction, error) {
+	script, err := NullDataScript(data)
+	if err != nil {
+		return nil, err
+	}
+	if fee <= 0 && feeRate <= 0 {
+		return nil, errors.New("fee of a data carrier transaction must be positive")
+	}
+
+	tx, spent, err := wallet.fundTransaction(utxoSet, []Output{{Value: 0, ScriptPubKey: hex.EncodeToString(script)}}, fee, feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wallet.signInputs(tx, spent); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
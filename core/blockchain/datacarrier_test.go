@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+func TestFindData(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity+1)
+	bc := cs.Blockchain()
+
+	// carry pays the coinbase at height to anyone along with payload in a data output
+	carry := func(height uint64, payload []byte) *Transaction {
+		b, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script, err := NullDataScript(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := newTestTx([]string{b.TxData[0].TxID}, Subsidy(height))
+		tx.Outputs = append(tx.Outputs, Output{Value: 0, ScriptPubKey: hex.EncodeToString(script)})
+		tx.TxID = tx.calculateID()
+		return tx
+	}
+	short := carry(0, []byte{0xab})
+	long := carry(1, []byte{0xab, 0xcd}) // its key starts with the key of short
+	b := newTestChainBlock(t, cs, tip, 30, *short, *long)
+	if _, err := cs.ProcessBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	store := bc.Store()
+
+	record := func(tx *Transaction, data string) DataRecord {
+		return DataRecord{Data: data, TxID: tx.TxID, OutputIndex: 1, BlockHash: b.Hash, Height: b.Height}
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []DataRecord
+	}{
+		{"exact match only", []byte{0xab}, []DataRecord{record(short, "ab")}},
+		{"longer payload", []byte{0xab, 0xcd}, []DataRecord{record(long, "abcd")}},
+		{"suffix of a payload", []byte{0xcd}, nil},
+		{"longer than any payload", []byte{0xab, 0xcd, 0xef}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.FindData(tt.payload)
+			if err != nil || !slices.Equal(records, tt.want) {
+				t.Errorf("FindData(%x) = %v, %v, want %v", tt.payload, records, err, tt.want)
+			}
+		})
+	}
+	if _, err := store.FindData(nil); err == nil {
+		t.Error("FindData() accepted an empty payload")
+	}
+
+	if _, err := cs.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range [][]byte{{0xab}, {0xab, 0xcd}} {
+		if records, err := store.FindData(payload); err != nil || len(records) != 0 {
+			t.Errorf("FindData(%x) after disconnect = %v, %v, want none", payload, records, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"math/big"
+	"time"
+)
+
+const (
+	PowLimitBits       = 0x200fffff       // easiest allowed target, a hash with one leading hex zero
+	InitialBits        = 0x2000ffff       // target of the genesis block and the first retarget window
+	TargetBlockSpacing = 30 * time.Second // desired average time between blocks
+	RetargetInterval   = 10               // number of blocks between difficulty adjustments
+)
+
+var powLimit = CompactToBig(PowLimitBits)
+
+// CompactToBig expands a compact target representation into the 256-bit target it encodes.
+// The compact form is a base-256 floating point number: the high byte is the exponent (the length
+// of the target in bytes) and the low 23 bits are the mantissa, bit 24 being the sign.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(int64(mantissa))
+	} else {
+		target = big.NewInt(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	if negative {
+		target.Neg(target)
+	}
+	return target
+}
+
+// BigToCompact converts a 256-bit target to its compact representation, losing the precision
+// beyond the 3 most significant bytes
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tmp := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = uint32(tmp.Bits()[0])
+	}
+
+	// the sign bit is part of the mantissa, so shift it out of the way if it is set
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// CalcWork returns the expected number of hashes needed to mine a block with the given compact target,
+// computed as 2^256 / (target + 1)
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+	return numerator.Div(numerator, denominator)
+}
+
+// hashToBig interprets a hex encoded block hash as a big-endian 256-bit number
+func hashToBig(hash string) (*big.Int, error) {
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(hashBytes), nil
+}
+
+// meetsTarget reports whether hash is less than or equal to the target encoded by bits
+func meetsTarget(hash string, bits uint32) bool {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 || target.Cmp(powLimit) > 0 {
+		return false
+	}
+
+	hashNum, err := hashToBig(hash)
+	if err != nil {
+		return false
+	}
+	return hashNum.Cmp(target) <= 0
+}
+
+// nextBits returns the compact target required for the child of parent, which is nil for the genesis block.
+//
+// The target is retargeted every RetargetInterval blocks by scaling it with the ratio between the time
+// the last window of blocks took to mine and the time it should have taken. The adjustment is limited
+// to a factor of 4 per retarget and the target never exceeds the proof-of-work limit.
+func nextBits(parent *blockNode) uint32 {
+	if parent == nil {
+		return InitialBits
+	}
+
+	height := parent.height + 1
+	if height%RetargetInterval != 0 {
+		return parent.bits
+	}
+
+	first := parent.ancestor(height - RetargetInterval)
+	if first == nil {
+		return parent.bits
+	}
+
+	actual := time.Duration(parent.timestamp-first.timestamp) * time.Second
+	expected := TargetBlockSpacing * (RetargetInterval - 1)
+	if actual < expected/4 {
+		actual = expected / 4
+	}
+	if actual > expected*4 {
+		actual = expected * 4
+	}
+
+	target := CompactToBig(parent.bits)
+	target.Mul(target, big.NewInt(int64(actual)))
+	target.Div(target, big.NewInt(int64(expected)))
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+
+	return BigToCompact(target)
+}
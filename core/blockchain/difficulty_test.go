@@ -0,0 +1,126 @@
+package blockchain
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		target  string // hex, with a leading minus for negative targets
+		back    uint32 // BigToCompact of the target, which may normalize the compact form
+	}{
+		{0x00000000, "0", 0x00000000},
+		{0x01003456, "0", 0x00000000},
+		{0x01123456, "12", 0x01120000},
+		{0x02008000, "80", 0x02008000},
+		{0x05009234, "92340000", 0x05009234},
+		{0x04923456, "-12345600", 0x04923456},
+		{0x04123456, "12345600", 0x04123456},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+		{InitialBits, "ffff" + zeros(58), InitialBits},
+		{PowLimitBits, "fffff" + zeros(58), PowLimitBits},
+	}
+
+	for _, tt := range tests {
+		want, _ := new(big.Int).SetString(tt.target, 16)
+		got := CompactToBig(tt.compact)
+		if got.Cmp(want) != 0 {
+			t.Errorf("CompactToBig(%#08x) = %x, want %s", tt.compact, got, tt.target)
+		}
+		if back := BigToCompact(got); back != tt.back {
+			t.Errorf("BigToCompact(%x) = %#08x, want %#08x", got, back, tt.back)
+		}
+	}
+}
+
+func zeros(n int) string {
+	return strings.Repeat("0", n)
+}
+
+func TestCalcWork(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		work string
+	}{
+		{0x1d00ffff, "100010001"},
+		{InitialBits, "100"},
+		{0x00000000, "0"},
+		{0x04923456, "0"},
+	}
+
+	for _, tt := range tests {
+		want, _ := new(big.Int).SetString(tt.work, 16)
+		if got := CalcWork(tt.bits); got.Cmp(want) != 0 {
+			t.Errorf("CalcWork(%#08x) = %x, want %s", tt.bits, got, tt.work)
+		}
+	}
+}
+
+func TestMeetsTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+		bits uint32
+		ok   bool
+	}{
+		{"below target", "0000" + "f" + zeros(59), InitialBits, true},
+		{"equal to target", "00ffff" + zeros(58), InitialBits, true},
+		{"above target", "010000" + zeros(58), InitialBits, false},
+		{"above pow limit", zeros(64), 0x2100ffff, false},
+		{"negative target", zeros(64), 0x04923456, false},
+		{"invalid hash", "xyz", InitialBits, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := meetsTarget(tt.hash, tt.bits); got != tt.ok {
+				t.Fatalf("meetsTarget() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+// testChain returns the tip of a chain of n blocks with the given bits, mined spacing apart
+func testChain(n int, bits uint32, spacing time.Duration) *blockNode {
+	var tip *blockNode
+	for i := 0; i < n; i++ {
+		b := &Block{
+			BlockHeader: BlockHeader{Timestamp: 1700000000 + int64(i)*int64(spacing/time.Second), Bits: bits},
+			Height:      uint64(i),
+		}
+		tip = newBlockNode(b, tip)
+	}
+	return tip
+}
+
+func TestNextBits(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocks  int
+		bits    uint32
+		spacing time.Duration
+		want    uint32
+	}{
+		{"genesis", 0, 0, 0, InitialBits},
+		{"between retargets", 5, InitialBits, time.Second, InitialBits},
+		{"on schedule", RetargetInterval, InitialBits, TargetBlockSpacing, InitialBits},
+		{"twice as fast", RetargetInterval, InitialBits, TargetBlockSpacing / 2, 0x1f7fff80},
+		{"twice as slow", RetargetInterval, InitialBits, 2 * TargetBlockSpacing, 0x2001fffe},
+		{"too fast, limited to a factor of 4", RetargetInterval, InitialBits, time.Second, 0x1f3fffc0},
+		{"too slow, limited to a factor of 4", RetargetInterval, InitialBits, 10 * TargetBlockSpacing, 0x2003fffc},
+		{"capped at the pow limit", RetargetInterval, PowLimitBits, 2 * TargetBlockSpacing, PowLimitBits},
+		{"second window", 2 * RetargetInterval, InitialBits, TargetBlockSpacing, InitialBits},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextBits(testChain(tt.blocks, tt.bits, tt.spacing)); got != tt.want {
+				t.Fatalf("nextBits() = %#08x, want %#08x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Canonical binary encoding of transactions, headers, blocks and utxos.
+//
+// The encoding is used both to compute hashes and as the storage and wire format, so every value
+// has exactly one encoding:
+//   - uint32 values are 4 bytes and int/uint64 values are 8 bytes, big-endian (ints as two's complement)
+//   - bools are a single byte, 0 or 1
+//   - strings and lists are prefixed with their length as an unsigned varint
+//
+// Transaction:  version u32 | is_coinbase bool | sender str | recipent str | amount i64 | timestamp i64 |
+//               inputs list | outputs list | lock_time u32
+// Input:        prev_tx_id str | output_index i64 | script_sig str | sequence u32
+// Output:       value i64 | script_pub_key str
+// BlockHeader:  version u32 | prev_hash str | merkle_root str | timestamp i64 | bits u32 | nonce i64
+// Block:        header | height u64 | transactions list
+// UTXO:         tx_id str | output_index i64 | value i64 | script_pub_key str | height u64 | is_coinbase bool
+// BlockUndo:    spent list of utxo
+// HeaderEntry:  header | height u64
+//
+// Transaction ids and block hashes are not encoded, they are recomputed when decoding.
+
+const (
+	maxEncodedStringLen = 1 << 20 // upper bound on a decoded string, to reject malformed length prefixes early
+	maxEncodedListLen   = 1 << 16 // upper bound on the number of inputs, outputs or transactions in a list
+
+	// smallest encodings of list elements, with empty strings and lists
+	minEncodedInputLen       = 1 + 8 + 1 + 4
+	minEncodedOutputLen      = 8 + 1
+	minEncodedTransactionLen = 4 + 1 + 1 + 1 + 8 + 8 + 1 + 1 + 4
+	minEncodedUTXOLen        = 1 + 8 + 8 + 1 + 8 + 1
+)
+
+var ErrMalformedEncoding = errors.New("malformed binary encoding")
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) writeUint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) writeUint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) writeInt(v int) {
+	e.writeUint64(uint64(int64(v)))
+}
+
+func (e *encoder) writeInt64(v int64) {
+	e.writeUint64(uint64(v))
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) writeLen(n int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n))
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeLen(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+// decoder reads values written by encoder. The first error is sticky:
+// once a read fails every following read returns zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrMalformedEncoding, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) next(n int, what string) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.fail("unexpected end of data reading %s", what)
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) readUint32(what string) uint32 {
+	b := d.next(4, what)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) readUint64(what string) uint64 {
+	b := d.next(8, what)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) readInt(what string) int {
+	return int(int64(d.readUint64(what)))
+}
+
+func (d *decoder) readInt64(what string) int64 {
+	return int64(d.readUint64(what))
+}
+
+func (d *decoder) readBool(what string) bool {
+	b := d.next(1, what)
+	if b == nil {
+		return false
+	}
+	if b[0] > 1 {
+		d.fail("invalid bool value %d for %s", b[0], what)
+		return false
+	}
+	return b[0] == 1
+}
+
+func (d *decoder) readLen(what string, max int) int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		d.fail("invalid length prefix of %s", what)
+		return 0
+	}
+	// reject non-minimal varints so that every value has a single encoding
+	if size != len(binary.AppendUvarint(nil, n)) {
+		d.fail("non-canonical length prefix of %s", what)
+		return 0
+	}
+	if n > uint64(max) {
+		d.fail("length %d of %s exceeds limit %d", n, what, max)
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+// readListLen reads the length of a list whose elements are encoded in at least minSize bytes each.
+// A length the remaining data cannot hold is rejected before the list is allocated.
+func (d *decoder) readListLen(what string, minSize int) int {
+	n := d.readLen(what, maxEncodedListLen)
+	if n > len(d.data)/minSize {
+		d.fail("%d %s do not fit in the remaining %d bytes", n, what, len(d.data))
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) readString(what string) string {
+	n := d.readLen(what, maxEncodedStringLen)
+	return string(d.next(n, what))
+}
+
+// finish returns the decoding error, or an error if data is left over
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) != 0 {
+		d.fail("%d trailing bytes", len(d.data))
+	}
+	return d.err
+}
+
+func (e *encoder) writeTransaction(tx *Transaction, withScriptSigs bool) {
+	e.writeUint32(tx.Version)
+	e.writeBool(tx.IsCoinbase)
+	e.writeString(tx.Sender)
+	e.writeString(tx.Recipent)
+	e.writeInt(tx.Amount)
+	e.writeInt64(tx.Timestamp)
+
+	e.writeLen(len(tx.Inputs))
+	for _, input := range tx.Inputs {
+		e.writeString(input.PrevTxID)
+		e.writeInt(input.OutputIndex)
+		if withScriptSigs {
+			e.writeString(input.ScriptSig)
+		} else {
+			e.writeString("")
+		}
+		e.writeUint32(input.Sequence)
+	}
+
+	e.writeLen(len(tx.Outputs))
+	for _, output := range tx.Outputs {
+		e.writeInt(output.Value)
+		e.writeString(output.ScriptPubKey)
+	}
+	e.writeUint32(tx.LockTime)
+}
+
+func (d *decoder) readTransaction() Transaction {
+	var tx Transaction
+	tx.Version = d.readUint32("transaction version")
+	tx.IsCoinbase = d.readBool("coinbase flag")
+	tx.Sender = d.readString("sender")
+	tx.Recipent = d.readString("recipent")
+	tx.Amount = d.readInt("amount")
+	tx.Timestamp = d.readInt64("transaction timestamp")
+
+	if n := d.readListLen("inputs", minEncodedInputLen); n > 0 {
+		tx.Inputs = make([]Input, n)
+		for i := range tx.Inputs {
+			tx.Inputs[i].PrevTxID = d.readString("input previous transaction id")
+			tx.Inputs[i].OutputIndex = d.readInt("input output index")
+			tx.Inputs[i].ScriptSig = d.readString("input scriptSig")
+			tx.Inputs[i].Sequence = d.readUint32("input sequence")
+		}
+	}
+
+	if n := d.readListLen("outputs", minEncodedOutputLen); n > 0 {
+		tx.Outputs = make([]Output, n)
+		for i := range tx.Outputs {
+			tx.Outputs[i].Value = d.readInt("output value")
+			tx.Outputs[i].ScriptPubKey = d.readString("output scriptPubKey")
+		}
+	}
+	tx.LockTime = d.readUint32("lock time")
+
+	if d.err == nil {
+		tx.TxID = tx.calculateID()
+	}
+	return tx
+}
+
+func (e *encoder) writeHeader(h *BlockHeader) {
+	e.writeUint32(h.Version)
+	e.writeString(h.PrevHash)
+	e.writeString(h.MerkleRoot)
+	e.writeInt64(h.Timestamp)
+	e.writeUint32(h.Bits)
+	e.writeInt(h.Nonce)
+}
+
+func (d *decoder) readHeader() BlockHeader {
+	var h BlockHeader
+	h.Version = d.readUint32("block version")
+	h.PrevHash = d.readString("previous block hash")
+	h.MerkleRoot = d.readString("merkle root")
+	h.Timestamp = d.readInt64("block timestamp")
+	h.Bits = d.readUint32("bits")
+	h.Nonce = d.readInt("nonce")
+	return h
+}
+
+// Serialize returns the canonical encoding of the transaction, including input scriptSigs
+func (tx *Transaction) Serialize() []byte {
+	var e encoder
+	e.writeTransaction(tx, true)
+	return e.buf
+}
+
+// DeserializeTransaction decodes a transaction written by Transaction.Serialize and computes its id
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	d := decoder{data: data}
+	tx := d.readTransaction()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Serialize returns the canonical encoding of the block header
+func (h *BlockHeader) Serialize() []byte {
+	var e encoder
+	e.writeHeader(h)
+	return e.buf
+}
+
+// DeserializeBlockHeader decodes a block header written by BlockHeader.Serialize
+func DeserializeBlockHeader(data []byte) (*BlockHeader, error) {
+	d := decoder{data: data}
+	h := d.readHeader()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Serialize returns the canonical encoding of the block
+func (b *Block) Serialize() []byte {
+	var e encoder
+	e.writeHeader(&b.BlockHeader)
+	e.writeUint64(b.Height)
+	e.writeLen(len(b.TxData))
+	for i := range b.TxData {
+		e.writeTransaction(&b.TxData[i], true)
+	}
+	return e.buf
+}
+
+// DeserializeBlock decodes a block written by Block.Serialize and computes its hash and transaction ids
+func DeserializeBlock(data []byte) (*Block, error) {
+	d := decoder{data: data}
+
+	var b Block
+	b.BlockHeader = d.readHeader()
+	b.Height = d.readUint64("block height")
+	if n := d.readListLen("transactions", minEncodedTransactionLen); n > 0 {
+		b.TxData = make([]Transaction, n)
+		for i := range b.TxData {
+			b.TxData[i] = d.readTransaction()
+		}
+	}
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	b.Hash = b.calculateHash()
+	return &b, nil
+}
+
+func (e *encoder) writeUTXO(u *UTXO) {
+	e.writeString(u.TxID)
+	e.writeInt(u.OutputIndex)
+	e.writeInt(u.Value)
+	e.writeString(u.ScriptPubKey)
+	e.writeUint64(u.Height)
+	e.writeBool(u.IsCoinbase)
+}
+
+func (d *decoder) readUTXO() UTXO {
+	var u UTXO
+	u.TxID = d.readString("utxo transaction id")
+	u.OutputIndex = d.readInt("utxo output index")
+	u.Value = d.readInt("utxo value")
+	u.ScriptPubKey = d.readString("utxo scriptPubKey")
+	u.Height = d.readUint64("utxo height")
+	u.IsCoinbase = d.readBool("utxo coinbase flag")
+	return u
+}
+
+// SerializeHeaderEntry returns the canonical encoding of the header and height of the block,
+// which the block tree is loaded from without reading the transactions
+func (b *Block) SerializeHeaderEntry() []byte {
+	var e encoder
+	e.writeHeader(&b.BlockHeader)
+	e.writeUint64(b.Height)
+	return e.buf
+}
+
+// DeserializeHeaderEntry decodes a header entry written by Block.SerializeHeaderEntry into a block without transactions
+func DeserializeHeaderEntry(data []byte) (*Block, error) {
+	d := decoder{data: data}
+
+	var b Block
+	b.BlockHeader = d.readHeader()
+	b.Height = d.readUint64("block height")
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	b.Hash = b.calculateHash()
+	return &b, nil
+}
+
+// Serialize returns the canonical encoding of the utxo
+func (u *UTXO) Serialize() []byte {
+	var e encoder
+	e.writeUTXO(u)
+	return e.buf
+}
+
+// DeserializeUTXO decodes a utxo written by UTXO.Serialize
+func DeserializeUTXO(data []byte) (*UTXO, error) {
+	d := decoder{data: data}
+	u := d.readUTXO()
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Serialize returns the canonical encoding of the undo record
+func (u *BlockUndo) Serialize() []byte {
+	var e encoder
+	e.writeLen(len(u.Spent))
+	for i := range u.Spent {
+		e.writeUTXO(&u.Spent[i])
+	}
+	return e.buf
+}
+
+// DeserializeBlockUndo decodes an undo record written by BlockUndo.Serialize
+func DeserializeBlockUndo(data []byte) (*BlockUndo, error) {
+	d := decoder{data: data}
+
+	var u BlockUndo
+	if n := d.readListLen("spent outputs", minEncodedUTXOLen); n > 0 {
+		u.Spent = make([]UTXO, n)
+		for i := range u.Spent {
+			u.Spent[i] = d.readUTXO()
+		}
+	}
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Serialize returns the canonical encoding of the data record
+func (r *DataRecord) Serialize() []byte {
+	var e encoder
+	e.writeString(r.Data)
+	e.writeString(r.TxID)
+	e.writeInt(r.OutputIndex)
+	e.writeString(r.BlockHash)
+	e.writeUint64(r.Height)
+	return e.buf
+}
+
+// DeserializeDataRecord decodes a data record written by DataRecord.Serialize
+func DeserializeDataRecord(data []byte) (*DataRecord, error) {
+	d := decoder{data: data}
+
+	var r DataRecord
+	r.Data = d.readString("data record payload")
+	r.TxID = d.readString("data record transaction id")
+	r.OutputIndex = d.readInt("data record output index")
+	r.BlockHash = d.readString("data record block hash")
+	r.Height = d.readUint64("data record height")
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Serialize returns the canonical encoding of the transaction location
+func (l *TxLocation) Serialize() []byte {
+	var e encoder
+	e.writeString(l.BlockHash)
+	e.writeInt(l.Position)
+	return e.buf
+}
+
+// DeserializeTxLocation decodes a transaction location written by TxLocation.Serialize
+func DeserializeTxLocation(data []byte) (*TxLocation, error) {
+	d := decoder{data: data}
+
+	var l TxLocation
+	l.BlockHash = d.readString("transaction location block hash")
+	l.Position = d.readInt("transaction location position")
+
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,262 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Known answer vectors of the canonical encoding, written out field by field
+var (
+	testTx = Transaction{
+		Version:   1,
+		Amount:    5,
+		Timestamp: 1700000000,
+		Inputs:    []Input{{PrevTxID: "ab", OutputIndex: 1, ScriptSig: "51", Sequence: MaxSequence}},
+		Outputs:   []Output{{Value: 5, ScriptPubKey: "51"}},
+	}
+	testTxHex = strings.Join([]string{
+		"00000001",         // version
+		"00",               // is_coinbase
+		"00",               // sender
+		"00",               // recipent
+		"0000000000000005", // amount
+		"000000006553f100", // timestamp
+		"01",               // inputs
+		"026162",           //   prev_tx_id
+		"0000000000000001", //   output_index
+		"023531",           //   script_sig
+		"ffffffff",         //   sequence
+		"01",               // outputs
+		"0000000000000005", //   value
+		"023531",           //   script_pub_key
+		"00000000",         // lock_time
+	}, "")
+	testTxID       = "cd01bd734d9656a1b8d62151784295931df1fbd4ea1453d8b04c7e076fb6c9a2"
+	testTxFullHash = "646a4ba7e275b882b3fb3697c6ffee7eaefb3d833d7812db97631f5755a089c9"
+
+	testHeader = BlockHeader{
+		Version:    1,
+		MerkleRoot: "aa",
+		Timestamp:  1700000000,
+		Bits:       0x2000ffff,
+		Nonce:      7,
+	}
+	testHeaderHex = strings.Join([]string{
+		"00000001",         // version
+		"00",               // prev_hash
+		"026161",           // merkle_root
+		"000000006553f100", // timestamp
+		"2000ffff",         // bits
+		"0000000000000007", // nonce
+	}, "")
+	testHeaderHash = "07dce8eb6c6e673817713c7beee89adab2234731b38e5e5917fbeccc5672a62e"
+)
+
+func TestTransactionKnownAnswer(t *testing.T) {
+	tx := testTx
+	if got := hex.EncodeToString(tx.Serialize()); got != testTxHex {
+		t.Fatalf("Serialize() = %s, want %s", got, testTxHex)
+	}
+	if got := tx.calculateID(); got != testTxID {
+		t.Fatalf("calculateID() = %s, want %s", got, testTxID)
+	}
+	if got := hex.EncodeToString(tx.FullHash()); got != testTxFullHash {
+		t.Fatalf("FullHash() = %s, want %s", got, testTxFullHash)
+	}
+
+	// the id is the hash of the encoding with empty scriptSigs
+	unsigned := tx
+	unsigned.Inputs = []Input{tx.Inputs[0]}
+	unsigned.Inputs[0].ScriptSig = ""
+	if got := hex.EncodeToString(unsigned.FullHash()); got != testTxID {
+		t.Fatalf("full hash without scriptSigs = %s, want the transaction id %s", got, testTxID)
+	}
+}
+
+func TestBlockHeaderKnownAnswer(t *testing.T) {
+	h := testHeader
+	if got := hex.EncodeToString(h.Serialize()); got != testHeaderHex {
+		t.Fatalf("Serialize() = %s, want %s", got, testHeaderHex)
+	}
+	if got := h.calculateHash(); got != testHeaderHash {
+		t.Fatalf("calculateHash() = %s, want %s", got, testHeaderHash)
+	}
+}
+
+func TestBlockKnownAnswer(t *testing.T) {
+	tx := testTx
+	tx.TxID = tx.calculateID()
+	b := Block{BlockHeader: testHeader, Height: 1, TxData: []Transaction{tx}}
+
+	want := testHeaderHex + "0000000000000001" + "01" + testTxHex
+	if got := hex.EncodeToString(b.Serialize()); got != want {
+		t.Fatalf("Serialize() = %s, want %s", got, want)
+	}
+	// the merkle root of a single transaction is its full hash
+	if root, err := b.CalculateMerkleRoot(); err != nil || root != testTxFullHash {
+		t.Fatalf("CalculateMerkleRoot() = %s, %v, want %s", root, err, testTxFullHash)
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	coinbase := newTestCoinbase(7, 50, 3)
+	data := newTestTx([]string{"aa", "bb"}, 0, 12)
+	data.Outputs[0].ScriptPubKey = "6a0568656c6c6f"
+	data.Sender, data.Recipent, data.Amount, data.LockTime = "sender", "recipent", 12, 500
+	data.Inputs[1].ScriptSig = "0102"
+	data.Inputs[1].Sequence = 10
+	data.TxID = data.calculateID()
+
+	for _, tx := range []*Transaction{coinbase, data, newTestTx(nil)} {
+		decoded, err := DeserializeTransaction(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, tx) {
+			t.Fatalf("DeserializeTransaction() = %+v, want %+v", decoded, tx)
+		}
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	b := newTestBlock(t, 3)
+	b.PrevHash = testHeaderHash
+	b.Bits = InitialBits
+	b.Nonce = 42
+	b.Hash = b.calculateHash()
+
+	decoded, err := DeserializeBlock(b.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, b) {
+		t.Fatalf("DeserializeBlock() = %+v, want %+v", decoded, b)
+	}
+
+	entry, err := DeserializeHeaderEntry(b.SerializeHeaderEntry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.BlockHeader != b.BlockHeader || entry.Height != b.Height || entry.Hash != b.Hash {
+		t.Fatalf("DeserializeHeaderEntry() = %+v, want header of %+v", entry, b)
+	}
+}
+
+func TestBlockUndoRoundTrip(t *testing.T) {
+	undo := &BlockUndo{Spent: []UTXO{
+		{TxID: testTxID, OutputIndex: 1, Value: 5, ScriptPubKey: "51", Height: 3, IsCoinbase: true},
+		{TxID: testTxFullHash, Value: 7, ScriptPubKey: "52", Height: 9},
+	}}
+	decoded, err := DeserializeBlockUndo(undo.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, undo) {
+		t.Fatalf("DeserializeBlockUndo() = %+v, want %+v", decoded, undo)
+	}
+}
+
+func TestDeserializeTransactionMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"truncated", testTxHex[:len(testTxHex)-2]},
+		{"trailing bytes", testTxHex + "00"},
+		{"invalid bool", "00000001" + "02" + testTxHex[10:]},
+		{"non-minimal length", "00000001" + "00" + "8000" + testTxHex[12:]},
+		{"string longer than data", "00000001" + "00" + "05"},
+		{"too many inputs", testTxHex[:46] + "ffff07"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DeserializeTransaction(data); !errors.Is(err, ErrMalformedEncoding) {
+				t.Fatalf("DeserializeTransaction() = %v, want %v", err, ErrMalformedEncoding)
+			}
+		})
+	}
+}
+
+func TestMinEncodedLens(t *testing.T) {
+	var input, output encoder
+	input.writeTransaction(&Transaction{Inputs: []Input{{}}}, true)
+	output.writeTransaction(&Transaction{Outputs: []Output{{}}}, true)
+	tx := (&Transaction{}).Serialize()
+
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"input", len(input.buf) - len(tx), minEncodedInputLen},
+		{"output", len(output.buf) - len(tx), minEncodedOutputLen},
+		{"transaction", len(tx), minEncodedTransactionLen},
+		{"utxo", len((&UTXO{}).Serialize()), minEncodedUTXOLen},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("smallest %s encoding is %d bytes, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDeserializeListLongerThanData(t *testing.T) {
+	maxLen := hex.EncodeToString(binary.AppendUvarint(nil, maxEncodedListLen))
+	emptyBlock := hex.EncodeToString((&Block{}).Serialize())
+
+	tests := []struct {
+		name        string
+		hex         string
+		deserialize func([]byte) error
+	}{
+		{"inputs", testTxHex[:46] + maxLen, func(data []byte) error {
+			_, err := DeserializeTransaction(data)
+			return err
+		}},
+		{"outputs", testTxHex[:46] + "00" + maxLen, func(data []byte) error {
+			_, err := DeserializeTransaction(data)
+			return err
+		}},
+		{"transactions", emptyBlock[:len(emptyBlock)-2] + maxLen, func(data []byte) error {
+			_, err := DeserializeBlock(data)
+			return err
+		}},
+		{"spent outputs", maxLen, func(data []byte) error {
+			_, err := DeserializeBlockUndo(data)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			err = tt.deserialize(data)
+			runtime.ReadMemStats(&after)
+
+			if !errors.Is(err, ErrMalformedEncoding) {
+				t.Fatalf("deserialize() = %v, want %v", err, ErrMalformedEncoding)
+			}
+			// a list of maxEncodedListLen elements takes megabytes
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<10 {
+				t.Errorf("deserialize() allocated %d bytes for %d bytes of data", allocated, len(data))
+			}
+		})
+	}
+}
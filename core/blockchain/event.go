@@ -9,6 +9,14 @@ type BlockRecEvent struct {
 	BlkHeight uint64
 }
 
+// ReorgEvent is sent when the main chain switches to a branch with more work.
+// Disconnected lists the hashes of the detached blocks from the old tip down to the fork point,
+// Connected lists the hashes of the attached blocks from the fork point up to the new tip.
+type ReorgEvent struct {
+	Disconnected []string
+	Connected    []string
+}
+
 type EventFeed[T any] struct {
 	subs map[string]chan<- T
 	mu   sync.Mutex
@@ -16,6 +24,7 @@ type EventFeed[T any] struct {
 
 type EventBus struct {
 	BlockFeed *EventFeed[BlockRecEvent]
+	ReorgFeed *EventFeed[ReorgEvent]
 }
 
 func NewEventFeed[T any]() *EventFeed[T] {
@@ -56,5 +65,6 @@ func (ef *EventFeed[T]) Send(event T) {
 func NewEventBus() *EventBus {
 	return &EventBus{
 		BlockFeed: NewEventFeed[BlockRecEvent](),
+		ReorgFeed: NewEventFeed[ReorgEvent](),
 	}
 }
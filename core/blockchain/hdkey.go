@@ -0,0 +1,194 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Keys of hierarchical deterministic wallets are derived from a master seed following BIP32,
+// adapted to the P256 curve the way SLIP-10 does for nist256p1: whenever an intermediate value
+// is not a valid private key, the derivation is repeated with the next HMAC output instead of
+// skipping the index. Non-hardened children can also be derived from the public parent key, which
+// lets a locked wallet hand out addresses without its private keys.
+
+// HardenedKeyStart is the first index of hardened child keys. Hardened keys are derived from the
+// private parent key, so leaking a child key and the parent chain code does not expose the parent.
+const HardenedKeyStart uint32 = 0x80000000
+
+const (
+	MinSeedSize = 16
+	MaxSeedSize = 64
+)
+
+// masterKeyHMACKey is the HMAC key deriving master keys of the P256 curve from a seed
+var masterKeyHMACKey = []byte("Nist256p1 seed")
+
+var (
+	ErrInvalidSeedSize = fmt.Errorf("seed must hold %d to %d bytes", MinSeedSize, MaxSeedSize)
+	ErrInvalidPath     = errors.New("invalid derivation path")
+	ErrDeriveBeyondMax = errors.New("derivation path is too deep")
+	ErrDeriveHardened  = errors.New("cannot derive a hardened key from a public key")
+)
+
+// ExtendedKey is a private or public key along with the chain code its child keys are derived with
+type ExtendedKey struct {
+	key       *big.Int // nil for public keys
+	x, y      *big.Int
+	chainCode []byte
+	depth     uint8
+}
+
+// newPrivateExtendedKey returns the extended key of the private key scalar key
+func newPrivateExtendedKey(key *big.Int, chainCode []byte, depth uint8) *ExtendedKey {
+	x, y := elliptic.P256().ScalarBaseMult(key.FillBytes(make([]byte, 32)))
+	return &ExtendedKey{key: key, x: x, y: y, chainCode: chainCode, depth: depth}
+}
+
+// NewMasterKey derives the master key of the hierarchy spanned by seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < MinSeedSize || len(seed) > MaxSeedSize {
+		return nil, ErrInvalidSeedSize
+	}
+
+	mac := hmac.New(sha512.New, masterKeyHMACKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	for {
+		key := new(big.Int).SetBytes(sum[:32])
+		if key.Sign() != 0 && key.Cmp(elliptic.P256().Params().N) < 0 {
+			return newPrivateExtendedKey(key, sum[32:], 0), nil
+		}
+		mac.Reset()
+		mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+}
+
+// Child derives the child key at index. Indexes from HardenedKeyStart on derive hardened keys,
+// which public keys cannot derive. The child of a public key is the public key of the child of
+// the matching private key.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == 0xff {
+		return nil, ErrDeriveBeyondMax
+	}
+	if index >= HardenedKeyStart && !k.IsPrivate() {
+		return nil, ErrDeriveHardened
+	}
+
+	curve := elliptic.P256()
+	var data []byte
+	if index >= HardenedKeyStart {
+		data = append([]byte{0x00}, k.key.FillBytes(make([]byte, 32))...)
+	} else {
+		data = elliptic.MarshalCompressed(curve, k.x, k.y)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	n := curve.Params().N
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(n) < 0 {
+			if k.IsPrivate() {
+				child := il.Add(il, k.key)
+				child.Mod(child, n)
+				if child.Sign() != 0 {
+					return newPrivateExtendedKey(child, sum[32:], k.depth+1), nil
+				}
+			} else {
+				x, y := curve.ScalarBaseMult(sum[:32])
+				x, y = curve.Add(x, y, k.x, k.y)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					return &ExtendedKey{x: x, y: y, chainCode: sum[32:], depth: k.depth + 1}, nil
+				}
+			}
+		}
+		data = append([]byte{0x01}, sum[32:]...)
+		data = binary.BigEndian.AppendUint32(data, index)
+	}
+}
+
+// Derive derives the key at path below k
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// IsPrivate reports whether k holds a private key
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.key != nil
+}
+
+// Public returns the public extended key of k, which derives the public keys of the non-hardened children of k
+func (k *ExtendedKey) Public() *ExtendedKey {
+	return &ExtendedKey{x: k.x, y: k.y, chainCode: k.chainCode, depth: k.depth}
+}
+
+// PrivateKey returns the ecdsa private key of the extended key, or nil for public keys
+func (k *ExtendedKey) PrivateKey() *ecdsa.PrivateKey {
+	if !k.IsPrivate() {
+		return nil
+	}
+	return &ecdsa.PrivateKey{D: new(big.Int).Set(k.key), PublicKey: *k.PublicKey()}
+}
+
+// PublicKey returns the ecdsa public key of the extended key
+func (k *ExtendedKey) PublicKey() *ecdsa.PublicKey {
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: k.x, Y: k.y}
+}
+
+// ParsePath parses a derivation path such as m/0'/1/2, where an apostrophe or h marks hardened indexes
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q does not start at the master key m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: invalid index %q", ErrInvalidPath, path, part)
+		}
+		if hardened {
+			index += uint64(HardenedKeyStart)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// FormatPath formats the derivation path of indexes the way ParsePath reads it
+func FormatPath(indexes []uint32) string {
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, index := range indexes {
+		if index >= HardenedKeyStart {
+			fmt.Fprintf(&sb, "/%d'", index-HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&sb, "/%d", index)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package blockchain
+
+// Transactions can be locked until a block height or time is reached, either absolutely with
+// Transaction.LockTime or relative to the block that created a spent output with Input.Sequence.
+const (
+	// LockTimeThreshold separates the two meanings of a lock time: below it the lock time
+	// is a block height, otherwise a unix time in seconds
+	LockTimeThreshold = 500000000
+
+	// MaxSequence marks an input as final. A transaction whose inputs are all final
+	// ignores its lock time.
+	MaxSequence = 0xffffffff
+
+	// The sequence number of an input of a transaction of version 2 or later holds a relative
+	// lock time unless the disable flag is set. The type flag selects units of 512 seconds
+	// instead of blocks, and the lock time itself is the value of the low 16 bits.
+	SequenceLockTimeDisableFlag = 1 << 31
+	SequenceLockTimeTypeFlag    = 1 << 22
+	SequenceLockTimeMask        = 0x0000ffff
+	SequenceLockTimeGranularity = 9 // time based relative lock times are in units of 2^9 seconds
+)
+
+// IsFinal reports whether tx can be included in the block at height whose previous blocks
+// have the median time medianTime. Time based lock times are compared against the median
+// time rather than the block timestamp, which miners are free to move forward.
+func (tx *Transaction) IsFinal(height uint64, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	if tx.LockTime < LockTimeThreshold {
+		if uint64(tx.LockTime) < height {
+			return true
+		}
+	} else if int64(tx.LockTime) < medianTime {
+		return true
+	}
+
+	for _, input := range tx.Inputs {
+		if input.Sequence != MaxSequence {
+			return false
+		}
+	}
+	return true
+}
+
+// hasRelativeLockTime reports whether the sequence number of input carries a relative lock time
+func (tx *Transaction) hasRelativeLockTime(input Input) bool {
+	return tx.Version >= 2 && !tx.IsCoinbase && input.Sequence&SequenceLockTimeDisableFlag == 0
+}
+
+// sequenceLocked reports whether the relative lock time in sequence prevents spending utxo
+// in the block following prev
+func sequenceLocked(sequence uint32, utxo UTXO, prev *blockNode) bool {
+	if prev == nil {
+		return true
+	}
+	value := int64(sequence & SequenceLockTimeMask)
+
+	if sequence&SequenceLockTimeTypeFlag == 0 {
+		return prev.height+1 < utxo.Height+uint64(value)
+	}
+
+	// time based locks count from the median time of the block before the one creating the output
+	var base int64
+	if utxo.Height > 0 {
+		if n := prev.ancestor(utxo.Height - 1); n != nil {
+			base = n.medianTimePast()
+		}
+	}
+	return prev.medianTimePast() < base+value<<SequenceLockTimeGranularity
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsFinal(t *testing.T) {
+	const height, medianTime = 100, LockTimeThreshold + 1000
+
+	tests := []struct {
+		name     string
+		lockTime uint32
+		sequence uint32
+		final    bool
+	}{
+		{"no lock time", 0, 0, true},
+		{"height below block height", height - 1, 0, true},
+		{"height equal to block height", height, 0, false},
+		{"height above block height", height + 1, 0, false},
+		{"largest height", LockTimeThreshold - 1, 0, false},
+		{"smallest time", LockTimeThreshold, 0, true},
+		{"time below median time", medianTime - 1, 0, true},
+		{"time equal to median time", medianTime, 0, false},
+		{"time above median time", medianTime + 1, 0, false},
+		{"final inputs ignore lock time", medianTime + 1, MaxSequence, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTestTx([]string{"aa", "bb"}, 1)
+			tx.LockTime = tt.lockTime
+			tx.Inputs[1].Sequence = tt.sequence
+			if got := tx.IsFinal(height, medianTime); got != tt.final {
+				t.Errorf("IsFinal() = %v, want %v", got, tt.final)
+			}
+		})
+	}
+}
+
+func TestHasRelativeLockTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  uint32
+		coinbase bool
+		sequence uint32
+		want     bool
+	}{
+		{"version 2", 2, false, 10, true},
+		{"time based", 2, false, SequenceLockTimeTypeFlag | 10, true},
+		{"version 1", 1, false, 10, false},
+		{"disable flag", 2, false, SequenceLockTimeDisableFlag | 10, false},
+		{"final input", 2, false, MaxSequence, false},
+		{"coinbase", 2, true, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTestTx([]string{"aa"}, 1)
+			tx.Version = tt.version
+			tx.IsCoinbase = tt.coinbase
+			tx.Inputs[0].Sequence = tt.sequence
+			if got := tx.hasRelativeLockTime(tx.Inputs[0]); got != tt.want {
+				t.Errorf("hasRelativeLockTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequenceLocked(t *testing.T) {
+	// with a block every 2^SequenceLockTimeGranularity seconds, the median time of a block
+	// at height h >= 10 is the timestamp of the block at h-5
+	tip := testChain(40, InitialBits, time.Second<<SequenceLockTimeGranularity)
+	utxo := UTXO{Height: 20}
+
+	tests := []struct {
+		name     string
+		sequence uint32
+		prev     uint64 // height of the block before the spending block
+		locked   bool
+	}{
+		{"height lock not reached", 3, 21, true},
+		{"height lock reached", 3, 22, false},
+		{"zero height lock", 0, 19, false},
+		{"time lock not reached", SequenceLockTimeTypeFlag | 3, 21, true},
+		{"time lock reached", SequenceLockTimeTypeFlag | 3, 22, false},
+		{"bits above the mask are ignored", 1<<16 | 3, 22, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sequenceLocked(tt.sequence, utxo, tip.ancestor(tt.prev)); got != tt.locked {
+				t.Errorf("sequenceLocked() = %v, want %v", got, tt.locked)
+			}
+		})
+	}
+
+	if !sequenceLocked(0, utxo, nil) {
+		t.Error("sequenceLocked() without a previous block = false, want true")
+	}
+}
+
+func TestLockTimeScripts(t *testing.T) {
+	tests := []struct {
+		name         string
+		version      uint32
+		lockTime     uint32
+		sequence     uint32
+		scriptPubKey []byte
+		err          error
+	}{
+		{"cltv equal", 2, 100, 0, script(100, OP_CHECKLOCKTIMEVERIFY), nil},
+		{"cltv below", 2, 100, 0, script(99, OP_CHECKLOCKTIMEVERIFY), nil},
+		{"cltv above", 2, 100, 0, script(101, OP_CHECKLOCKTIMEVERIFY), ErrUnsatisfiedLockTime},
+		{"cltv time against height", 2, 100, 0, script(LockTimeThreshold, OP_CHECKLOCKTIMEVERIFY), ErrUnsatisfiedLockTime},
+		{"cltv height against time", 2, LockTimeThreshold + 100, 0, script(100, OP_CHECKLOCKTIMEVERIFY), ErrUnsatisfiedLockTime},
+		{"cltv final input", 2, 100, MaxSequence, script(100, OP_CHECKLOCKTIMEVERIFY), ErrUnsatisfiedLockTime},
+		{"cltv negative", 2, 100, 0, script(-1, OP_CHECKLOCKTIMEVERIFY), ErrNegativeLockTime},
+		{"cltv empty stack", 2, 100, 0, script(OP_CHECKLOCKTIMEVERIFY), ErrStackUnderflow},
+		{"csv equal", 2, 0, 10, script(10, OP_CHECKSEQUENCEVERIFY), nil},
+		{"csv above", 2, 0, 10, script(11, OP_CHECKSEQUENCEVERIFY), ErrUnsatisfiedLockTime},
+		{"csv time against height", 2, 0, 10, script(SequenceLockTimeTypeFlag|10, OP_CHECKSEQUENCEVERIFY), ErrUnsatisfiedLockTime},
+		{"csv time", 2, 0, SequenceLockTimeTypeFlag | 10, script(SequenceLockTimeTypeFlag|10, OP_CHECKSEQUENCEVERIFY), nil},
+		{"csv disabled operand", 2, 0, 0, script(SequenceLockTimeDisableFlag|11, OP_CHECKSEQUENCEVERIFY), nil},
+		{"csv disabled input", 2, 0, SequenceLockTimeDisableFlag | 10, script(10, OP_CHECKSEQUENCEVERIFY), ErrUnsatisfiedLockTime},
+		{"csv version 1", 1, 0, 10, script(10, OP_CHECKSEQUENCEVERIFY), ErrUnsatisfiedLockTime},
+		{"csv negative", 2, 0, 10, script(-1, OP_CHECKSEQUENCEVERIFY), ErrNegativeLockTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTestTx([]string{"aa"}, 1)
+			tx.Version = tt.version
+			tx.LockTime = tt.lockTime
+			tx.Inputs[0].Sequence = tt.sequence
+			checker := txInputChecker{tx: tx, index: 0}
+			if err := VerifyScript(nil, tt.scriptPubKey, checker); !errors.Is(err, tt.err) {
+				t.Fatalf("VerifyScript() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNonFinalTxRejected(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity)
+	genesis, err := cs.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// locked until the block after the next one
+	locked := newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0))
+	locked.LockTime = uint32(tip.Height + 1)
+	locked.Inputs[0].Sequence = 0
+	locked.TxID = locked.calculateID()
+
+	if err := cs.AcceptTx(locked); !errors.Is(err, ErrNonFinalTx) {
+		t.Errorf("AcceptTx(non-final) = %v, want %v", err, ErrNonFinalTx)
+	}
+	if cs.Mempool().HasTx(locked.TxID) {
+		t.Error("non-final transaction added to the mempool")
+	}
+	b := newTestChainBlock(t, cs, tip, 30, *locked)
+	if _, err := cs.ProcessBlock(b); !errors.Is(err, ErrNonFinalTx) {
+		t.Errorf("ProcessBlock(non-final) = %v, want %v", err, ErrNonFinalTx)
+	}
+
+	// final in the block after the next one
+	tip = extendTestChain(t, cs, tip, 1)
+	if err := cs.AcceptTx(locked); err != nil {
+		t.Errorf("AcceptTx(final) = %v", err)
+	}
+	b = newTestChainBlock(t, cs, tip, 30, *locked)
+	if _, err := cs.ProcessBlock(b); err != nil {
+		t.Errorf("ProcessBlock(final) = %v", err)
+	}
+}
@@ -1,30 +1,68 @@
 package blockchain
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 )
 
+var ErrMempoolConflict = errors.New("transaction spends an output already spent by a mempool transaction")
+
+// MempoolEntry is a pending transaction together with the fee it pays and its encoded size in bytes
+type MempoolEntry struct {
+	Tx   *Transaction
+	Fee  int
+	Size int
+}
+
+// HasHigherFeeRate reports whether e pays more fee per byte than other
+func (e *MempoolEntry) HasHigherFeeRate(other *MempoolEntry) bool {
+	return e.Fee*other.Size > other.Fee*e.Size
+}
+
+// Mempool holds the transactions waiting to be mined. No two of them spend the same output,
+// so that every transaction of the mempool can be mined along with the others.
 type Mempool struct {
-	transactions map[string]*Transaction
+	transactions map[string]*MempoolEntry
+	spends       map[string]string // outpoints spent by mempool transactions mapped to the id of the spending transaction
 	mu           sync.Mutex
 }
 
 func NewMempool() *Mempool {
 	return &Mempool{
-		transactions: make(map[string]*Transaction),
+		transactions: make(map[string]*MempoolEntry),
+		spends:       make(map[string]string),
 	}
 }
 
-func (m *Mempool) AddTx(tx *Transaction) {
+// AddTx adds tx paying the given fee to the mempool. It fails with ErrMempoolConflict
+// if tx spends an output that a transaction of the mempool already spends.
+func (m *Mempool) AddTx(tx *Transaction, fee int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, exists := m.transactions[tx.TxID]; exists {
 		log.Info("Cannot add new transaction. Already exists in mempool", tx.TxID)
+		return nil
 	}
 
-	m.transactions[tx.TxID] = tx
+	for _, input := range tx.SpentInputs() {
+		if spender, exists := m.spends[outpoint(input.PrevTxID, input.OutputIndex)]; exists {
+			return fmt.Errorf("%w: %s", ErrMempoolConflict, spender)
+		}
+	}
+	for _, input := range tx.SpentInputs() {
+		m.spends[outpoint(input.PrevTxID, input.OutputIndex)] = tx.TxID
+	}
+
+	m.transactions[tx.TxID] = &MempoolEntry{
+		Tx:   tx,
+		Fee:  fee,
+		Size: len(tx.Serialize()),
+	}
 	log.Info("Transaction added to the mempool", tx.TxID)
+	return nil
 }
 
 func (m *Mempool) RemoveTx(txID string) {
@@ -34,6 +72,74 @@ func (m *Mempool) RemoveTx(txID string) {
 	if _, exists := m.transactions[txID]; !exists {
 		log.Info("Transaction not found in mempool", txID)
 	} else {
-		delete(m.transactions, txID)
+		m.removeTx(txID)
+	}
+}
+
+func (m *Mempool) removeTx(txID string) {
+	for _, input := range m.transactions[txID].Tx.SpentInputs() {
+		delete(m.spends, outpoint(input.PrevTxID, input.OutputIndex))
+	}
+	delete(m.transactions, txID)
+}
+
+// RemoveConflicts removes the transactions of the mempool spending an output that tx spends,
+// such as when tx was mined, other than tx itself. It returns the ids of the removed transactions.
+func (m *Mempool) RemoveConflicts(tx *Transaction) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var removed []string
+	for _, input := range tx.SpentInputs() {
+		spender, exists := m.spends[outpoint(input.PrevTxID, input.OutputIndex)]
+		if !exists || spender == tx.TxID {
+			continue
+		}
+		m.removeTx(spender)
+		removed = append(removed, spender)
 	}
+	return removed
+}
+
+// HasTx reports whether the transaction with id txID is in the mempool
+func (m *Mempool) HasTx(txID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.transactions[txID]
+	return exists
+}
+
+// Tx returns the transaction with id txID if it is in the mempool
+func (m *Mempool) Tx(txID string) (*Transaction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, exists := m.transactions[txID]
+	if !exists {
+		return nil, false
+	}
+	return entry.Tx, true
+}
+
+// EntriesByFeeRate returns the mempool entries ordered from the highest to the lowest fee rate
+func (m *Mempool) EntriesByFeeRate() []*MempoolEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]*MempoolEntry, 0, len(m.transactions))
+	for _, entry := range m.transactions {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].HasHigherFeeRate(entries[j]) {
+			return true
+		}
+		if entries[j].HasHigherFeeRate(entries[i]) {
+			return false
+		}
+		return entries[i].Tx.TxID < entries[j].Tx.TxID
+	})
+	return entries
 }
@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMempoolConflicts(t *testing.T) {
+	m := NewMempool()
+	a := newTestTx([]string{"aa", "bb"}, 1)
+	b := newTestTx([]string{"cc"}, 2)
+	if err := m.AddTx(a, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddTx(b, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddTx(a, 1); err != nil {
+		t.Fatalf("adding a transaction twice: %v", err)
+	}
+
+	// spends output 1 of bb, which a spends as well
+	conflict := newTestTx([]string{"dd", "bb"}, 3)
+	if err := m.AddTx(conflict, 5); !errors.Is(err, ErrMempoolConflict) {
+		t.Fatalf("AddTx() = %v, want %v", err, ErrMempoolConflict)
+	}
+	if m.HasTx(conflict.TxID) {
+		t.Fatal("conflicting transaction added")
+	}
+
+	// once the conflicting transaction is mined, a is evicted and its outputs are free again
+	if removed := m.RemoveConflicts(conflict); !slices.Equal(removed, []string{a.TxID}) {
+		t.Fatalf("RemoveConflicts() = %v, want %v", removed, []string{a.TxID})
+	}
+	if m.HasTx(a.TxID) || !m.HasTx(b.TxID) {
+		t.Fatal("wrong transactions evicted")
+	}
+	if removed := m.RemoveConflicts(b); len(removed) != 0 {
+		t.Fatalf("transaction conflicts with itself: %v", removed)
+	}
+	if err := m.AddTx(newTestTx([]string{"aa"}, 4), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	m.RemoveTx(b.TxID)
+	if err := m.AddTx(newTestTx([]string{"cc"}, 5), 1); err != nil {
+		t.Fatalf("output of a removed transaction still spent: %v", err)
+	}
+}
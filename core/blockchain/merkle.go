@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// The merkle tree of a block is built from the full hashes of its transactions, which unlike
+// transaction ids cover the scriptSigs, so that the block hash commits to every byte of the block.
+
+// MerkleProof proves that a transaction is included in a block with a given merkle root.
+// TxHash is the hex encoded full hash of the transaction, which is the leaf of the tree.
+// Siblings holds the hex encoded hashes paired with the leaf on the way up to the root,
+// and Index is the position of the transaction in the block, which tells on which side each sibling goes.
+type MerkleProof struct {
+	TxID     string   `json:"transaction_id"`
+	TxHash   string   `json:"transaction_hash"`
+	Index    int      `json:"index"`
+	Siblings []string `json:"siblings"`
+}
+
+// hashPair returns the double sha256 hash of the concatenation of left and right
+func hashPair(left, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// merkleLevels builds the merkle tree of the given hex encoded leaves and returns all its levels,
+// starting with the leaves and ending with the root. Levels with an odd number of nodes
+// pair the last node with itself. Since duplicating the last nodes of a list of leaves then
+// gives the same root, trees pairing two identical nodes are rejected with ErrMutatedMerkleTree.
+func merkleLevels(hashes []string) ([][][]byte, error) {
+	if len(hashes) == 0 {
+		return nil, errors.New("cannot build merkle tree without transactions")
+	}
+
+	leaves := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		leaf, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merkle leaf [%s]: %v", hash, err)
+		}
+		leaves[i] = leaf
+	}
+
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+				if bytes.Equal(level[i], right) {
+					return nil, ErrMutatedMerkleTree
+				}
+			}
+			next = append(next, hashPair(level[i], right))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels, nil
+}
+
+// MerkleRoot returns the hex encoded merkle root of the given hex encoded leaves
+func MerkleRoot(hashes []string) (string, error) {
+	levels, err := merkleLevels(hashes)
+	if err != nil {
+		return "", err
+	}
+	root := levels[len(levels)-1][0]
+	return hex.EncodeToString(root), nil
+}
+
+// TxIDs returns the ids of the transactions of the block in block order
+func (b *Block) TxIDs() []string {
+	txids := make([]string, len(b.TxData))
+	for i, tx := range b.TxData {
+		txids[i] = tx.TxID
+	}
+	return txids
+}
+
+// TxHashes returns the full hashes of the transactions of the block in block order, which are the leaves of its merkle tree
+func (b *Block) TxHashes() []string {
+	hashes := make([]string, len(b.TxData))
+	for i := range b.TxData {
+		hashes[i] = hex.EncodeToString(b.TxData[i].FullHash())
+	}
+	return hashes
+}
+
+// CalculateMerkleRoot returns the merkle root of the transactions of the block
+func (b *Block) CalculateMerkleRoot() (string, error) {
+	return MerkleRoot(b.TxHashes())
+}
+
+// MerkleProof returns a proof that the transaction with id txid is included in the block
+func (b *Block) MerkleProof(txid string) (*MerkleProof, error) {
+	txids := b.TxIDs()
+	index := -1
+	for i, id := range txids {
+		if id == txid {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("transaction:[%s] not found in block:[%s]", txid, b.Hash)
+	}
+
+	hashes := b.TxHashes()
+	levels, err := merkleLevels(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &MerkleProof{TxID: txid, TxHash: hashes[index], Index: index}
+	pos := index
+	for _, level := range levels[:len(levels)-1] {
+		sibling := pos ^ 1
+		if sibling >= len(level) {
+			sibling = pos
+		}
+		proof.Siblings = append(proof.Siblings, hex.EncodeToString(level[sibling]))
+		pos /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that proof links the full hash of its transaction to the hex encoded merkle root.
+// Holders of the transaction should check that its full hash is proof.TxHash.
+func VerifyMerkleProof(proof *MerkleProof, merkleRoot string) bool {
+	if proof == nil || proof.Index < 0 {
+		return false
+	}
+
+	hash, err := hex.DecodeString(proof.TxHash)
+	if err != nil {
+		return false
+	}
+
+	pos := proof.Index
+	for _, s := range proof.Siblings {
+		sibling, err := hex.DecodeString(s)
+		if err != nil {
+			return false
+		}
+		if pos%2 == 0 {
+			hash = hashPair(hash, sibling)
+		} else {
+			hash = hashPair(sibling, hash)
+		}
+		pos /= 2
+	}
+
+	return pos == 0 && hex.EncodeToString(hash) == merkleRoot
+}
@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// newTestBlock returns a block at height 1 holding a coinbase and n transactions, with its merkle root set
+func newTestBlock(t *testing.T, n int) *Block {
+	t.Helper()
+	b := &Block{Height: 1, TxData: []Transaction{*newTestCoinbase(1, Subsidy(1))}}
+	for i := 0; i < n; i++ {
+		b.TxData = append(b.TxData, *newTestTx([]string{fmt.Sprintf("%064x", i)}, i+1))
+	}
+	root, err := b.CalculateMerkleRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.MerkleRoot = root
+	return b
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 0; n < 8; n++ {
+		b := newTestBlock(t, n)
+		for i, tx := range b.TxData {
+			t.Run(fmt.Sprintf("%d txs/tx %d", n+1, i), func(t *testing.T) {
+				proof, err := b.MerkleProof(tx.TxID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if proof.Index != i {
+					t.Fatalf("proof index = %d, want %d", proof.Index, i)
+				}
+				if !VerifyMerkleProof(proof, b.MerkleRoot) {
+					t.Fatal("valid proof rejected")
+				}
+
+				proof.TxHash = b.TxHashes()[(i+1)%len(b.TxData)]
+				if len(b.TxData) > 1 && VerifyMerkleProof(proof, b.MerkleRoot) {
+					t.Fatal("proof of another transaction accepted")
+				}
+			})
+		}
+	}
+}
+
+func TestMerkleProofUnknownTx(t *testing.T) {
+	b := newTestBlock(t, 2)
+	if _, err := b.MerkleProof(fmt.Sprintf("%064x", 99)); err == nil {
+		t.Fatal("proof of a transaction not in the block")
+	}
+}
+
+func TestMerkleRootCommitsToScriptSigs(t *testing.T) {
+	b := newTestBlock(t, 2)
+	root := b.MerkleRoot
+	id := b.TxData[1].TxID
+
+	b.TxData[1].Inputs[0].ScriptSig = "51"
+	if b.TxData[1].calculateID() != id {
+		t.Fatal("scriptSig changed the transaction id")
+	}
+	if err := b.checkMerkleRoot(); !errors.Is(err, ErrInvalidMerkleRoot) {
+		t.Fatalf("checkMerkleRoot() = %v, want %v", err, ErrInvalidMerkleRoot)
+	}
+	if got, _ := b.CalculateMerkleRoot(); got == root {
+		t.Fatal("scriptSig did not change the merkle root")
+	}
+}
+
+func TestCheckMerkleRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(b *Block)
+		err    error
+	}{
+		{"valid", func(b *Block) {}, nil},
+		{"duplicated last transaction", func(b *Block) {
+			b.TxData = append(b.TxData, b.TxData[len(b.TxData)-1])
+		}, ErrDuplicateTx},
+		{"reordered transactions", func(b *Block) {
+			b.TxData[1], b.TxData[2] = b.TxData[2], b.TxData[1]
+		}, ErrInvalidMerkleRoot},
+		{"missing transaction", func(b *Block) {
+			b.TxData = b.TxData[:2]
+		}, ErrInvalidMerkleRoot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBlock(t, 2)
+			tt.mutate(b)
+			if err := b.checkMerkleRoot(); !errors.Is(err, tt.err) {
+				t.Fatalf("checkMerkleRoot() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMerkleLevelsMutated(t *testing.T) {
+	a, b, c := fmt.Sprintf("%064x", 1), fmt.Sprintf("%064x", 2), fmt.Sprintf("%064x", 3)
+	root, err := MerkleRoot([]string{a, b, c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pairing c with itself gives the root of [a b c], which must not be accepted for [a b c c]
+	if _, err := MerkleRoot([]string{a, b, c, c}); !errors.Is(err, ErrMutatedMerkleTree) {
+		t.Fatalf("MerkleRoot() = %v, want %v", err, ErrMutatedMerkleTree)
+	}
+	if got, _ := MerkleRoot([]string{a, b, c}); got != root {
+		t.Fatal("merkle root is not deterministic")
+	}
+}
@@ -1,51 +1,104 @@
 package blockchain
 
 import (
+	"encoding/binary"
 	"encoding/hex"
-	"strings"
 	"time"
 )
 
 type Miner struct {
 	wallet      *Wallet
+	address     string // address the coinbase pays to
 	blkRecEvent <-chan BlockRecEvent
+	reorgEvent  <-chan ReorgEvent
 }
 
-func NewMiner(wallet *Wallet, blockRecEvent <-chan BlockRecEvent) (*Miner, error) {
+func NewMiner(wallet *Wallet, blockRecEvent <-chan BlockRecEvent, reorgEvent <-chan ReorgEvent) (*Miner, error) {
 	return &Miner{
 		wallet:      wallet,
+		address:     wallet.Address,
 		blkRecEvent: blockRecEvent,
+		reorgEvent:  reorgEvent,
 	}, nil
 }
 
-// CollectTransactions returns transaction(s) up to maxTxs pending from mempool
-func (m *Miner) CollectTransactions(mem *Mempool, maxTxs int) []Transaction {
-	txCount := 0
+// RenewAddress switches the coinbase of the following blocks to a fresh address of an HD wallet,
+// so that every mined block pays to its own address. Single-key wallets keep their only address.
+func (m *Miner) RenewAddress() error {
+	if !m.wallet.IsHD() {
+		return nil
+	}
+	address, err := m.wallet.NewAddress()
+	if err != nil {
+		return err
+	}
+	m.address = address
+	return nil
+}
+
+// NewBlockTemplate creates a block template on top of the tip of cs, holding the coinbase followed by the
+// transactions of its mempool picked by collectTransactions. The tip, the height, the utxo view and the
+// transactions are all taken under the lock of cs, so the template extends the tip its transactions were
+// validated against. Only the nonce is left for the miner to fill in.
+func (m *Miner) NewBlockTemplate(cs *ChainState, maxSize int) *Block {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	tip := cs.blockchain.tipNode()
+	var height uint64
+	if tip != nil {
+		height = tip.height + 1
+	}
+
+	txs, fees := m.collectTransactions(cs, tip, maxSize)
+	coinbaseTx := m.GenerateCoinbaseTx(height, fees)
+	return newBlock(tip, append([]Transaction{coinbaseTx}, txs...))
+}
+
+// collectTransactions assembles the transactions of a block template on top of tip from the mempool of cs,
+// picking them by fee rate until their total size reaches maxSize bytes. It returns the picked transactions along
+// with their total fees. Transactions that do not validate against the utxo set, are not final yet, or conflict
+// with an already collected transaction, are skipped so the mined block passes block validation.
+// The caller must hold the lock of cs, so that tip is the tip of the utxo set.
+func (m *Miner) collectTransactions(cs *ChainState, tip *blockNode, maxSize int) ([]Transaction, int) {
+	mem := cs.Mempool()
+	view := newUTXOView(cs.UTXOSet(), tip)
 	var txs []Transaction
-	for _, tx := range mem.transactions {
-		if txCount >= maxTxs {
-			break
+	size := 0
+	fees := 0
+	for _, entry := range mem.EntriesByFeeRate() {
+		if size+entry.Size > maxSize {
+			continue
+		}
+		fee, err := view.checkTx(entry.Tx)
+		if err != nil {
+			log.Warnf("Skipping transaction:[%s] from mempool: %v\n", entry.Tx.TxID, err)
+			continue
 		}
-		txs = append(txs, *tx)
-		txCount++
+		view.connect(entry.Tx)
+		txs = append(txs, *entry.Tx)
+		size += entry.Size
+		fees += fee
 	}
-	return txs
+	return txs, fees
 }
 
-// MineBlock performs proof-of-work for a block, returns true if block is mined, false if
-func (m *Miner) MineBlock(block *Block, difficulty int) *Block {
-	prefix := strings.Repeat("0", difficulty)
-
+// MineBlock performs proof-of-work for a block until its hash meets the block target.
+// Returns the mined block, or nil if mining was aborted because the chain moved on.
+func (m *Miner) MineBlock(block *Block) *Block {
 	for i := 0; ; i++ {
 		select {
 		case incomingBlock := <-m.blkRecEvent:
 			if incomingBlock.BlkHeight == block.Height {
 				return nil
 			}
+		case <-m.reorgEvent:
+			// the block being mined no longer extends the tip
+			return nil
 		default:
 			block.Nonce = i
 			hash := block.calculateHash()
-			if strings.HasPrefix(hash, prefix) {
+			if meetsTarget(hash, block.Bits) {
 				block.Hash = hash
 				return block
 			}
@@ -55,29 +108,43 @@ func (m *Miner) MineBlock(block *Block, difficulty int) *Block {
 	}
 }
 
-func (m *Miner) GenerateCoinbaseTx() Transaction {
-	coinbaseReward := 6 // hardcoded block reward amount value; block reward halving not implemented
+// GenerateCoinbaseTx creates the coinbase transaction for the block at height,
+// paying the block subsidy and the fees collected from the block transactions to the miner wallet.
+// Once the supply is exhausted, a block without fees has nothing to pay, and as only data carrier outputs
+// may have a zero value, its coinbase carries the block height in a data output instead.
+func (m *Miner) GenerateCoinbaseTx(height uint64, fees int) Transaction {
+	coinbaseReward := Subsidy(height) + fees
 	var outputs []Output
 
-	WalletPubKeyHash, err := AddressToPubKeyHash(m.wallet.Address)
+	scriptPubKey, err := AddressToScriptPubKey(m.address)
 	if err != nil {
 		log.Error("Invalid Wallet address")
 		return Transaction{}
 	}
+	if coinbaseReward == 0 {
+		script, err := NullDataScript(binary.BigEndian.AppendUint64(nil, height))
+		if err != nil {
+			log.Error("Error creating coinbase data output: ", err)
+			return Transaction{}
+		}
+		scriptPubKey = hex.EncodeToString(script)
+	}
 
 	rewardOutput := Output{
 		Value:        coinbaseReward,
-		ScriptPubKey: hex.EncodeToString(WalletPubKeyHash),
+		ScriptPubKey: scriptPubKey,
 	}
 
 	outputs = append(outputs, rewardOutput)
 	coinbaseTx := Transaction{
+		Version:    TxVersion,
 		Amount:     coinbaseReward,
-		Recipent:   m.wallet.Address,
+		Recipent:   m.address,
 		IsCoinbase: true,
+		Inputs:     []Input{coinbaseInput(height)},
 		Outputs:    outputs,
-		Timestamps: time.Now().String(),
+		Timestamp:  time.Now().Unix(),
 	}
-	coinbaseTx.TxID = hex.EncodeToString(coinbaseTx.Hash())
+	coinbaseTx.TxID = coinbaseTx.calculateID()
 	return coinbaseTx
 }
@@ -0,0 +1,75 @@
+package blockchain
+
+import "testing"
+
+func TestGenerateCoinbaseTx(t *testing.T) {
+	miner, err := NewMiner(newTestWallet(t), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exhausted := uint64(6 * HalvingInterval) // the subsidy has halved down to zero
+
+	tests := []struct {
+		name   string
+		height uint64
+		fees   int
+		value  int
+		data   bool
+	}{
+		{"subsidy", 1, 0, Subsidy(1), false},
+		{"subsidy and fees", 1, 7, Subsidy(1) + 7, false},
+		{"fees only", exhausted, 7, 7, false},
+		{"no reward", exhausted, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coinbase := miner.GenerateCoinbaseTx(tt.height, tt.fees)
+			if err := checkCoinbase(&coinbase, tt.height, tt.fees); err != nil {
+				t.Fatalf("checkCoinbase() = %v", err)
+			}
+			output := coinbase.Outputs[0]
+			if output.Value != tt.value || output.IsUnspendable() != tt.data {
+				t.Errorf("coinbase output = %+v, want value %d, data carrier %v", output, tt.value, tt.data)
+			}
+		})
+	}
+}
+
+func TestNewBlockTemplate(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity)
+	genesis, err := cs.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0)-3)
+	if err := cs.AcceptTx(spend); err != nil {
+		t.Fatal(err)
+	}
+
+	miner, err := NewMiner(newTestWallet(t), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := miner.NewBlockTemplate(cs, MaxBlockTxsSize)
+	if b.PrevHash != tip.Hash || b.Height != tip.Height+1 {
+		t.Fatalf("template at height %d on %s, want height %d on the tip %s", b.Height, b.PrevHash, tip.Height+1, tip.Hash)
+	}
+	if len(b.TxData) != 2 || b.TxData[1].TxID != spend.TxID {
+		t.Fatalf("template holds %d transactions, want the coinbase and the mempool transaction", len(b.TxData))
+	}
+	if got, want := b.TxData[0].Outputs[0].Value, Subsidy(b.Height)+3; got != want {
+		t.Errorf("coinbase pays %d, want the subsidy plus fees %d", got, want)
+	}
+
+	for b.Hash = b.calculateHash(); !meetsTarget(b.Hash, b.Bits); b.Hash = b.calculateHash() {
+		b.Nonce++
+	}
+	if _, err := cs.ProcessBlock(b); err != nil {
+		t.Fatalf("ProcessBlock(template) = %v", err)
+	}
+	if cs.Mempool().HasTx(spend.TxID) {
+		t.Error("mined transaction left in the mempool")
+	}
+}
@@ -0,0 +1,61 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Seeds of HD wallets are derived from BIP39 mnemonics, word lists encoding random entropy
+// with a checksum, so that a wallet can be backed up by writing down its words. An optional
+// passphrase is mixed into the seed, so the same words restore a different wallet under a
+// different passphrase.
+
+// MnemonicEntropyBits is the entropy of the mnemonics of new wallets, which encode it in 24 words
+const MnemonicEntropyBits = 256
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// newMnemonic generates the words of a new wallet
+func newMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(MnemonicEntropyBits)
+	if err != nil {
+		return "", fmt.Errorf("Error generating entropy for mnemonic: %v", err)
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// mnemonicSeed validates the words and checksum of mnemonic and derives the seed it spans under passphrase
+func mnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+	}
+	return seed, nil
+}
+
+// RestoreWallet rebuilds and saves the HD wallet spanned by mnemonic and mnemonicPassphrase,
+// encrypted with walletPassphrase unless it is empty. The restored wallet is returned unlocked
+// and only knows the keys within the gap limit, Rescan finds the keys used beyond them.
+func RestoreWallet(id, mnemonic, mnemonicPassphrase, walletPassphrase string) (*Wallet, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	seed, err := mnemonicSeed(mnemonic, mnemonicPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newWalletFromMnemonic(id, mnemonic, seed, walletPassphrase)
+}
+
+// Mnemonic returns the words the wallet was created from, or an empty string for wallets
+// created from a bare seed or a single key. It fails while the wallet is locked.
+func (wallet *Wallet) Mnemonic() (string, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if wallet.secrets == nil {
+		return "", ErrWalletLocked
+	}
+	return wallet.secrets.Mnemonic, nil
+}
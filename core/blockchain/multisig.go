@@ -0,0 +1,140 @@
+package blockchain
+
+import (
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MultisigAddress is a pay-to-script-hash address whose outputs can only be spent
+// with signatures of M of its N public keys
+type MultisigAddress struct {
+	Address      string   `json:"address"`
+	RedeemScript string   `json:"redeem_script"` // hex encoded
+	M            int      `json:"m"`
+	PubKeys      []string `json:"pub_keys"` // hex encoded, in the order signatures have to follow
+}
+
+// NewMultisigAddress creates an m-of-n multisig address over the given uncompressed public keys.
+// Spending transactions have to provide the signatures in the order of pubKeys.
+func NewMultisigAddress(m int, pubKeys [][]byte) (*MultisigAddress, error) {
+	hexKeys := make([]string, len(pubKeys))
+	for i, pubKey := range pubKeys {
+		if x, _ := elliptic.Unmarshal(elliptic.P256(), pubKey); x == nil {
+			return nil, fmt.Errorf("Invalid public key %d of multisig address", i)
+		}
+		hexKeys[i] = hex.EncodeToString(pubKey)
+	}
+
+	redeemScript, err := MultisigScript(m, pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	// the redeem script is pushed by the scriptSig, so it has to fit in a single element
+	if len(redeemScript) > MaxScriptElementSize {
+		return nil, fmt.Errorf("redeem script of %d keys exceeds the maximum element size", len(pubKeys))
+	}
+
+	return &MultisigAddress{
+		Address:      ScriptHashToAddress(hash160(redeemScript)),
+		RedeemScript: hex.EncodeToString(redeemScript),
+		M:            m,
+		PubKeys:      hexKeys,
+	}, nil
+}
+
+// PublicKeyBytes returns the uncompressed encoding of the wallet public key, as pushed by scripts
+func (wallet *Wallet) PublicKeyBytes() []byte {
+	return elliptic.Marshal(elliptic.P256(), wallet.PublicKey.X, wallet.PublicKey.Y)
+}
+
+// MultisigTx collects the signatures of the owners of a multisig address for a transaction
+// spending its outputs. It can be passed around as JSON: each owner signs it with
+// Wallet.SignMultisig, and once M owners have signed Finalize fills in the scriptSigs.
+type MultisigTx struct {
+	Tx         *Transaction        `json:"transaction"`
+	Address    *MultisigAddress    `json:"address"`
+	Spent      []UTXO              `json:"spent"`      // outputs spent by the inputs, which signatures commit to
+	Signatures []map[string]string `json:"signatures"` // per input, hex public key to hex signature
+}
+
+// NewMultisigTx starts collecting signatures for tx, whose inputs spend the outputs spent of addr,
+// given in input order. The inputs and outputs of tx must not change anymore, as signatures commit to them.
+func NewMultisigTx(tx *Transaction, addr *MultisigAddress, spent []UTXO) (*MultisigTx, error) {
+	if len(spent) != len(tx.Inputs) {
+		return nil, errors.New("spent outputs do not match the inputs of the transaction")
+	}
+	sigs := make([]map[string]string, len(tx.Inputs))
+	for i := range sigs {
+		sigs[i] = make(map[string]string)
+	}
+	return &MultisigTx{Tx: tx, Address: addr, Spent: spent, Signatures: sigs}, nil
+}
+
+// SignMultisig adds the signature of the wallet to every input of mtx.
+// The wallet key must be one of the keys of the multisig address.
+func (wallet *Wallet) SignMultisig(mtx *MultisigTx) error {
+	pubKey := hex.EncodeToString(wallet.PublicKeyBytes())
+	if !slices.Contains(mtx.Address.PubKeys, pubKey) {
+		return fmt.Errorf("wallet key is not a key of multisig address %s", mtx.Address.Address)
+	}
+	if len(mtx.Signatures) != len(mtx.Tx.Inputs) || len(mtx.Spent) != len(mtx.Tx.Inputs) {
+		return errors.New("signatures do not match the inputs of the transaction")
+	}
+
+	key, err := wallet.key(wallet.Address)
+	if err != nil {
+		return err
+	}
+
+	for i := range mtx.Tx.Inputs {
+		sig, err := mtx.Tx.SignInput(i, mtx.Spent[i], SigHashAll, key)
+		if err != nil {
+			return fmt.Errorf("Error signing input %d: %v", i, err)
+		}
+		mtx.Signatures[i][pubKey] = hex.EncodeToString(sig)
+	}
+	return nil
+}
+
+// Finalize sets the scriptSig of every input of the transaction from the collected signatures,
+// taking the first M of them in key order, and returns the transaction ready to be broadcast
+func (mtx *MultisigTx) Finalize() (*Transaction, error) {
+	redeemScript, err := hex.DecodeString(mtx.Address.RedeemScript)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding redeem script hex: %v", err)
+	}
+	if len(mtx.Signatures) != len(mtx.Tx.Inputs) {
+		return nil, errors.New("signatures do not match the inputs of the transaction")
+	}
+
+	for i := range mtx.Tx.Inputs {
+		var b ScriptBuilder
+		count := 0
+		for _, pubKey := range mtx.Address.PubKeys {
+			if count == mtx.Address.M {
+				break
+			}
+			sigHex, exists := mtx.Signatures[i][pubKey]
+			if !exists {
+				continue
+			}
+			sig, err := hex.DecodeString(sigHex)
+			if err != nil {
+				return nil, fmt.Errorf("Error decoding signature hex of input %d: %v", i, err)
+			}
+			b.AddData(sig)
+			count++
+		}
+		if count < mtx.Address.M {
+			return nil, fmt.Errorf("input %d has %d of %d required signatures", i, count, mtx.Address.M)
+		}
+
+		mtx.Tx.Inputs[i].ScriptSig = hex.EncodeToString(b.AddData(redeemScript).Script())
+	}
+
+	mtx.Tx.TxID = mtx.Tx.calculateID()
+	return mtx.Tx, nil
+}
@@ -0,0 +1,108 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestMultisigSpend(t *testing.T) {
+	owners := []*Wallet{newTestWallet(t), newTestWallet(t), newTestWallet(t)}
+	pubKeys := make([][]byte, len(owners))
+	for i, owner := range owners {
+		pubKeys[i] = owner.PublicKeyBytes()
+	}
+	addr, err := NewMultisigAddress(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := AddressToScriptPubKey(addr.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signers []int
+		ok      bool
+	}{
+		{"first and last", []int{2, 0}, true},
+		{"first two", []int{0, 1}, true},
+		{"all three", []int{0, 1, 2}, true},
+		{"one signature", []int{1}, false},
+		{"none", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			funding := newTestCoinbase(1, 50)
+			spent := []UTXO{{TxID: funding.TxID, Value: 50, ScriptPubKey: script, Height: 1}}
+			tx := newTestTx([]string{funding.TxID}, 49)
+			mtx, err := NewMultisigTx(tx, addr, spent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range tt.signers {
+				if err := owners[i].SignMultisig(mtx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			signed, err := mtx.Finalize()
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("finalized without enough signatures")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := UnlockUTXO(signed, 0, spent[0]); err != nil {
+				t.Fatalf("multisig input does not unlock its output: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignMultisigForeignKey(t *testing.T) {
+	owners := []*Wallet{newTestWallet(t), newTestWallet(t)}
+	addr, err := NewMultisigAddress(1, [][]byte{owners[0].PublicKeyBytes(), owners[1].PublicKeyBytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := newTestTx([]string{"aa"}, 1)
+	mtx, err := NewMultisigTx(tx, addr, []UTXO{{TxID: "aa", Value: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newTestWallet(t).SignMultisig(mtx); err == nil {
+		t.Fatal("signed with a key of another address")
+	}
+}
+
+func TestNewMultisigAddressInvalid(t *testing.T) {
+	key := newTestWallet(t).PublicKeyBytes()
+	tests := []struct {
+		name    string
+		m       int
+		pubKeys [][]byte
+	}{
+		{"no keys", 1, nil},
+		{"m zero", 0, [][]byte{key}},
+		{"m above n", 2, [][]byte{key}},
+		{"invalid key", 1, [][]byte{[]byte("not a key")}},
+		{"too many keys", 1, make([][]byte, MaxPubKeysPerMultisig+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.pubKeys {
+				if tt.pubKeys[i] == nil {
+					tt.pubKeys[i] = key
+				}
+			}
+			if _, err := NewMultisigAddress(tt.m, tt.pubKeys); err == nil {
+				t.Fatal("invalid multisig address created")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import "time"
+
+// Consensus parameters of the coin supply.
+// The subsidy starts at InitialSubsidy and halves every HalvingInterval blocks until it reaches zero.
+const (
+	InitialSubsidy  = 50
+	HalvingInterval = 210000
+	MaxSupply       = 20370000 // sum of the subsidies of the whole schedule; issuance never exceeds it
+)
+
+// ChainID identifies the chain in signature hashes, so that signatures cannot be replayed on other chains
+const ChainID = 0x6d696e62 // "minb"
+
+// CoinbaseMaturity is the number of blocks a coinbase output has to be buried under before it can be spent
+const CoinbaseMaturity = 10
+
+// Consensus rules on block timestamps
+const (
+	MedianTimeBlocks   = 11            // number of previous blocks whose median timestamp a new block must exceed
+	MaxFutureBlockTime = 2 * time.Hour // how far ahead of the local clock a block timestamp may be
+)
+
+const (
+	MaxBlockSize = 1 << 20 // maximum size of an encoded block in bytes
+
+	// MaxBlockTxsSize is the space of a block template available to mempool transactions,
+	// the rest is left for the header and the coinbase transaction
+	MaxBlockTxsSize = MaxBlockSize - 1000
+)
+
+// scheduledSubsidy returns the subsidy of the halving schedule at height, without the supply cap
+func scheduledSubsidy(height uint64) int {
+	halvings := height / HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return InitialSubsidy >> halvings
+}
+
+// TotalIssued returns the number of coins the schedule allows to be created by the blocks below height
+func TotalIssued(height uint64) int {
+	total := 0
+	for start := uint64(0); start < height; start += HalvingInterval {
+		subsidy := scheduledSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+		blocks := min(height-start, HalvingInterval)
+		total += subsidy * int(blocks)
+		if total >= MaxSupply {
+			return MaxSupply
+		}
+	}
+	return total
+}
+
+// Subsidy returns the maximum number of new coins the coinbase of the block at height may create
+func Subsidy(height uint64) int {
+	return min(scheduledSubsidy(height), MaxSupply-TotalIssued(height))
+}
@@ -0,0 +1,769 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Scripts lock and unlock outputs. An output carries a scriptPubKey and the input spending it
+// a scriptSig; the input is valid if executing the scriptSig and then the scriptPubKey on the
+// same stack leaves a true value on top.
+//
+// A script is a sequence of opcodes. Opcodes 0x01-0x4b push the next that many bytes, the
+// PUSHDATA opcodes push data prefixed with a 1 or 2 byte little-endian length, and the other
+// opcodes operate on the stack. Scripts, stack elements, the stack itself and the number of
+// executed opcodes are bounded, so that executing any script is cheap.
+//
+// Numbers on the stack are little-endian with the sign in the high bit of the last byte,
+// and must be minimally encoded.
+//
+// A pay-to-script-hash scriptPubKey (OP_HASH160 <hash> OP_EQUAL) commits to a redeem script,
+// which the spending scriptSig pushes last. Once the scriptPubKey succeeds, the redeem script
+// is executed on the stack left by the scriptSig.
+
+// Opcode is a single script instruction
+type Opcode byte
+
+const (
+	OP_0         Opcode = 0x00 // push an empty element
+	OP_PUSHDATA1 Opcode = 0x4c // push data prefixed with a 1 byte length
+	OP_PUSHDATA2 Opcode = 0x4d // push data prefixed with a 2 byte little-endian length
+	OP_1         Opcode = 0x51 // OP_1 to OP_16 push the number they are named after
+	OP_16        Opcode = 0x60
+
+	OP_VERIFY Opcode = 0x69 // fail unless the top element is true, and pop it
+	OP_RETURN Opcode = 0x6a // fail immediately
+
+	OP_DROP Opcode = 0x75 // pop the top element
+	OP_DUP  Opcode = 0x76 // duplicate the top element
+
+	OP_EQUAL       Opcode = 0x87 // pop two elements and push whether they are equal
+	OP_EQUALVERIFY Opcode = 0x88 // OP_EQUAL followed by OP_VERIFY
+
+	OP_SHA256  Opcode = 0xa8 // replace the top element with its sha256 hash
+	OP_HASH160 Opcode = 0xa9 // replace the top element with the ripemd160 hash of its sha256 hash
+	OP_HASH256 Opcode = 0xaa // replace the top element with its double sha256 hash
+
+	OP_CHECKSIG       Opcode = 0xac // pop a public key and a signature and push whether the signature is valid
+	OP_CHECKSIGVERIFY Opcode = 0xad // OP_CHECKSIG followed by OP_VERIFY
+
+	// OP_CHECKMULTISIG pops a key count n, n public keys, a signature count m and m signatures,
+	// and pushes whether every signature is valid for one of the keys, in key order
+	OP_CHECKMULTISIG       Opcode = 0xae
+	OP_CHECKMULTISIGVERIFY Opcode = 0xaf // OP_CHECKMULTISIG followed by OP_VERIFY
+
+	// OP_CHECKLOCKTIMEVERIFY fails unless the lock time of the transaction is at least the top element,
+	// of the same kind (height or time), and the input is not final. The element is left on the stack.
+	OP_CHECKLOCKTIMEVERIFY Opcode = 0xb1
+	// OP_CHECKSEQUENCEVERIFY fails unless the relative lock time of the input is at least the top element
+	// and of the same kind. It does nothing if the disable flag of the element is set.
+	OP_CHECKSEQUENCEVERIFY Opcode = 0xb2
+
+	// OP_DATA_1 to OP_DATA_75 push the next 1 to 75 bytes
+	OP_DATA_1  Opcode = 0x01
+	OP_DATA_75 Opcode = 0x4b
+)
+
+// Resource limits of script execution
+const (
+	MaxScriptSize         = 10000 // maximum size of a script in bytes
+	MaxScriptElementSize  = 520   // maximum size of a pushed element in bytes
+	MaxStackSize          = 1000  // maximum number of elements on the stack
+	MaxOpsPerScript       = 201   // maximum number of non-push opcodes executed per script, counting each multisig key
+	MaxPubKeysPerMultisig = 16    // maximum number of public keys of OP_CHECKMULTISIG
+	maxScriptNumLen       = 4     // maximum size of a number operand in bytes
+	maxLockTimeNumLen     = 5     // lock time operands need 5 bytes to hold every uint32
+)
+
+var (
+	ErrScriptTooLarge        = errors.New("script exceeds the maximum script size")
+	ErrScriptElementTooLarge = errors.New("pushed element exceeds the maximum element size")
+	ErrStackOverflow         = errors.New("stack exceeds the maximum number of elements")
+	ErrTooManyOps            = errors.New("script exceeds the maximum number of operations")
+	ErrStackUnderflow        = errors.New("operation requires more stack elements")
+	ErrMalformedPush         = errors.New("push exceeds the end of the script")
+	ErrUnknownOpcode         = errors.New("unknown opcode")
+	ErrVerifyFailed          = errors.New("verify operation failed")
+	ErrEarlyReturn           = errors.New("script executed OP_RETURN")
+	ErrScriptSigNotPushOnly  = errors.New("scriptSig contains non-push operations")
+	ErrScriptFailed          = errors.New("script did not leave a true value on the stack")
+	ErrInvalidScriptNum      = errors.New("invalid number operand")
+	ErrInvalidPubKeyCount    = errors.New("invalid multisig public key count")
+	ErrInvalidSigCount       = errors.New("invalid multisig signature count")
+	ErrNegativeLockTime      = errors.New("negative lock time operand")
+	ErrUnsatisfiedLockTime   = errors.New("lock time requirement not satisfied")
+)
+
+// txChecker verifies signatures and lock times against the transaction being validated
+type txChecker interface {
+	checkSig(sig, pubKey []byte) bool
+	checkLockTime(lockTime int64) bool
+	checkSequence(sequence int64) bool
+}
+
+// txInputChecker checks the scripts of input index of tx, which spends utxo
+type txInputChecker struct {
+	tx    *Transaction
+	index int
+	utxo  UTXO
+}
+
+// checkSig verifies sig, whose last byte is the signature hash type, against the signature hash of the input
+func (c txInputChecker) checkSig(sig, pubKey []byte) bool {
+	if len(sig) == 0 {
+		return false
+	}
+	hashType := SigHashType(sig[len(sig)-1])
+	hash, err := c.tx.SignatureHash(c.index, c.utxo, hashType)
+	if err != nil {
+		return false
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubKey)
+	if x == nil {
+		return false
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	return ecdsa.VerifyASN1(publicKey, hash, sig[:len(sig)-1])
+}
+
+func (c txInputChecker) checkLockTime(lockTime int64) bool {
+	txLockTime := int64(c.tx.LockTime)
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return false
+	}
+	if lockTime > txLockTime {
+		return false
+	}
+	// a final input would let the transaction ignore its lock time
+	return c.tx.Inputs[c.index].Sequence != MaxSequence
+}
+
+func (c txInputChecker) checkSequence(sequence int64) bool {
+	txSequence := int64(c.tx.Inputs[c.index].Sequence)
+	if !c.tx.hasRelativeLockTime(c.tx.Inputs[c.index]) {
+		return false
+	}
+
+	const mask = SequenceLockTimeTypeFlag | SequenceLockTimeMask
+	sequence &= mask
+	txSequence &= mask
+	if (sequence < SequenceLockTimeTypeFlag) != (txSequence < SequenceLockTimeTypeFlag) {
+		return false
+	}
+	return sequence <= txSequence
+}
+
+// scriptOp is a parsed script instruction along with the data it pushes
+type scriptOp struct {
+	opcode Opcode
+	data   []byte
+}
+
+func (op scriptOp) isPush() bool {
+	return op.opcode <= OP_PUSHDATA2 || op.opcode >= OP_1 && op.opcode <= OP_16
+}
+
+// parseScript splits script into its instructions
+func parseScript(script []byte) ([]scriptOp, error) {
+	if len(script) > MaxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		op := scriptOp{opcode: Opcode(script[i])}
+		i++
+
+		n := -1
+		switch {
+		case op.opcode >= OP_DATA_1 && op.opcode <= OP_DATA_75:
+			n = int(op.opcode)
+		case op.opcode == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(script[i])
+			i++
+		case op.opcode == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		}
+
+		if n >= 0 {
+			if i+n > len(script) {
+				return nil, ErrMalformedPush
+			}
+			op.data = script[i : i+n]
+			i += n
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// IsPushOnly reports whether script is well formed and contains only push operations
+func IsPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !op.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptEngine executes scripts on a shared stack
+type scriptEngine struct {
+	stack   [][]byte
+	checker txChecker
+	numOps  int // operations executed by the current script
+}
+
+func (e *scriptEngine) push(data []byte) error {
+	if len(data) > MaxScriptElementSize {
+		return ErrScriptElementTooLarge
+	}
+	if len(e.stack) >= MaxStackSize {
+		return ErrStackOverflow
+	}
+	e.stack = append(e.stack, data)
+	return nil
+}
+
+func (e *scriptEngine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+func (e *scriptEngine) pushBool(v bool) error {
+	if v {
+		return e.push([]byte{1})
+	}
+	return e.push(nil)
+}
+
+// popBool pops the top element and interprets it as a boolean.
+// Any non-zero byte is true, except for a negative zero.
+func (e *scriptEngine) popBool() (bool, error) {
+	data, err := e.pop()
+	if err != nil {
+		return false, err
+	}
+	return castToBool(data), nil
+}
+
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+// popInt pops the top element and decodes it as a number
+func (e *scriptEngine) popInt() (int64, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeScriptNum(data, maxScriptNumLen)
+}
+
+// peekLockTime decodes the lock time operand on top of the stack without popping it
+func (e *scriptEngine) peekLockTime() (int64, error) {
+	if len(e.stack) == 0 {
+		return 0, ErrStackUnderflow
+	}
+	lockTime, err := decodeScriptNum(e.stack[len(e.stack)-1], maxLockTimeNumLen)
+	if err != nil {
+		return 0, err
+	}
+	if lockTime < 0 {
+		return 0, ErrNegativeLockTime
+	}
+	return lockTime, nil
+}
+
+// popN pops n elements and returns them in the order they were pushed
+func (e *scriptEngine) popN(n int) ([][]byte, error) {
+	if len(e.stack) < n {
+		return nil, ErrStackUnderflow
+	}
+	elems := slices.Clone(e.stack[len(e.stack)-n:])
+	e.stack = e.stack[:len(e.stack)-n]
+	return elems, nil
+}
+
+// decodeScriptNum decodes a minimally encoded number of at most maxLen bytes
+func decodeScriptNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, ErrInvalidScriptNum
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	// the last byte may only be zero, or the sign byte alone, if the previous byte needs its high bit
+	if last := data[len(data)-1]; last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, ErrInvalidScriptNum
+	}
+
+	var v int64
+	for i, b := range data {
+		v |= int64(b) << (8 * i)
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		v &^= int64(0x80) << (8 * (len(data) - 1))
+		return -v, nil
+	}
+	return v, nil
+}
+
+// encodeScriptNum returns the minimal encoding of v
+func encodeScriptNum(v int64) []byte {
+	if v == 0 {
+		return nil
+	}
+	negative := v < 0
+	abs := v
+	if negative {
+		abs = -v
+	}
+
+	var data []byte
+	for abs > 0 {
+		data = append(data, byte(abs&0xff))
+		abs >>= 8
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		if negative {
+			data = append(data, 0x80)
+		} else {
+			data = append(data, 0)
+		}
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+	return data
+}
+
+func (e *scriptEngine) verify() error {
+	ok, err := e.popBool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+// execute runs script on the stack of the engine
+func (e *scriptEngine) execute(script []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	e.numOps = 0
+	for _, op := range ops {
+		if !op.isPush() {
+			if err := e.countOps(1); err != nil {
+				return err
+			}
+		}
+		if err := e.step(op); err != nil {
+			return fmt.Errorf("%w (opcode 0x%02x)", err, byte(op.opcode))
+		}
+	}
+	return nil
+}
+
+func (e *scriptEngine) countOps(n int) error {
+	e.numOps += n
+	if e.numOps > MaxOpsPerScript {
+		return ErrTooManyOps
+	}
+	return nil
+}
+
+func (e *scriptEngine) step(op scriptOp) error {
+	switch {
+	case op.opcode == OP_0:
+		return e.push(nil)
+	case op.opcode <= OP_PUSHDATA2:
+		return e.push(op.data)
+	case op.opcode >= OP_1 && op.opcode <= OP_16:
+		return e.push([]byte{byte(op.opcode-OP_1) + 1})
+	}
+
+	switch op.opcode {
+	case OP_VERIFY:
+		return e.verify()
+
+	case OP_RETURN:
+		return ErrEarlyReturn
+
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+
+	case OP_DUP:
+		if len(e.stack) == 0 {
+			return ErrStackUnderflow
+		}
+		return e.push(e.stack[len(e.stack)-1])
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if err := e.pushBool(bytes.Equal(a, b)); err != nil {
+			return err
+		}
+		if op.opcode == OP_EQUALVERIFY {
+			return e.verify()
+		}
+		return nil
+
+	case OP_SHA256, OP_HASH160, OP_HASH256:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		switch op.opcode {
+		case OP_SHA256:
+			return e.push(hash[:])
+		case OP_HASH160:
+			return e.push(hash160(data))
+		default:
+			second := sha256.Sum256(hash[:])
+			return e.push(second[:])
+		}
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if err := e.pushBool(e.checker.checkSig(sig, pubKey)); err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKSIGVERIFY {
+			return e.verify()
+		}
+		return nil
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		lockTime, err := e.peekLockTime()
+		if err != nil {
+			return err
+		}
+		if !e.checker.checkLockTime(lockTime) {
+			return ErrUnsatisfiedLockTime
+		}
+		return nil
+
+	case OP_CHECKSEQUENCEVERIFY:
+		sequence, err := e.peekLockTime()
+		if err != nil {
+			return err
+		}
+		if sequence&SequenceLockTimeDisableFlag != 0 {
+			return nil
+		}
+		if !e.checker.checkSequence(sequence) {
+			return ErrUnsatisfiedLockTime
+		}
+		return nil
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		ok, err := e.checkMultisig()
+		if err != nil {
+			return err
+		}
+		if err := e.pushBool(ok); err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKMULTISIGVERIFY {
+			return e.verify()
+		}
+		return nil
+	}
+
+	return ErrUnknownOpcode
+}
+
+// checkMultisig pops the operands of OP_CHECKMULTISIG and reports whether the signatures
+// match the public keys. Signatures have to be in the same order as the keys they belong to,
+// so each key is tried at most once.
+func (e *scriptEngine) checkMultisig() (bool, error) {
+	n, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > MaxPubKeysPerMultisig {
+		return false, ErrInvalidPubKeyCount
+	}
+	if err := e.countOps(int(n)); err != nil {
+		return false, err
+	}
+	pubKeys, err := e.popN(int(n))
+	if err != nil {
+		return false, err
+	}
+
+	m, err := e.popInt()
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, ErrInvalidSigCount
+	}
+	sigs, err := e.popN(int(m))
+	if err != nil {
+		return false, err
+	}
+
+	k := 0
+	for _, sig := range sigs {
+		for k < len(pubKeys) && !e.checker.checkSig(sig, pubKeys[k]) {
+			k++
+		}
+		if k == len(pubKeys) {
+			return false, nil
+		}
+		k++
+	}
+	return true, nil
+}
+
+// hash160 returns the ripemd160 hash of the sha256 hash of data
+func hash160(data []byte) []byte {
+	sha256Hash := sha256.Sum256(data)
+	ripemd160Hasher := ripemd160.New()
+	ripemd160Hasher.Write(sha256Hash[:])
+	return ripemd160Hasher.Sum(nil)
+}
+
+// VerifyScript executes scriptSig and then scriptPubKey on the same stack, checking signatures
+// with checker. The scriptSig may only push data, and the scripts succeed if they leave a true
+// value on top of the stack.
+func VerifyScript(scriptSig, scriptPubKey []byte, checker txChecker) error {
+	if !IsPushOnly(scriptSig) {
+		return ErrScriptSigNotPushOnly
+	}
+
+	e := &scriptEngine{checker: checker}
+	if err := e.execute(scriptSig); err != nil {
+		return err
+	}
+	sigStack := slices.Clone(e.stack)
+
+	if err := e.execute(scriptPubKey); err != nil {
+		return err
+	}
+	if len(e.stack) == 0 || !castToBool(e.stack[len(e.stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	if _, ok := extractScriptHash(scriptPubKey); !ok {
+		return nil
+	}
+
+	// pay-to-script-hash: the scriptPubKey only checked the hash of the redeem script,
+	// which now runs against the rest of the scriptSig stack
+	if len(sigStack) == 0 {
+		return ErrStackUnderflow
+	}
+	redeemScript := sigStack[len(sigStack)-1]
+	e.stack = sigStack[:len(sigStack)-1]
+	if err := e.execute(redeemScript); err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+	if len(e.stack) == 0 || !castToBool(e.stack[len(e.stack)-1]) {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// ScriptBuilder assembles scripts, encoding data pushes with the smallest push operation
+type ScriptBuilder struct {
+	script []byte
+}
+
+// AddOp appends opcode op to the script
+func (b *ScriptBuilder) AddOp(op Opcode) *ScriptBuilder {
+	b.script = append(b.script, byte(op))
+	return b
+}
+
+// AddData appends a push of data to the script
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	n := len(data)
+	switch {
+	case n == 0:
+		b.script = append(b.script, byte(OP_0))
+	case n <= int(OP_DATA_75):
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, byte(OP_PUSHDATA1), byte(n))
+	default:
+		b.script = append(b.script, byte(OP_PUSHDATA2))
+		b.script = binary.LittleEndian.AppendUint16(b.script, uint16(n))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt appends a push of the number v, using OP_0 and OP_1 to OP_16 for small numbers
+func (b *ScriptBuilder) AddInt(v int64) *ScriptBuilder {
+	if v == 0 {
+		return b.AddOp(OP_0)
+	}
+	if v >= 1 && v <= 16 {
+		return b.AddOp(OP_1 + Opcode(v-1))
+	}
+	return b.AddData(encodeScriptNum(v))
+}
+
+// Script returns the assembled script
+func (b *ScriptBuilder) Script() []byte {
+	return b.script
+}
+
+// PayToPubKeyHashScript returns the standard pay-to-pubkey-hash scriptPubKey:
+// OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHashScript(pubKeyHash []byte) []byte {
+	var b ScriptBuilder
+	return b.AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// extractPubKeyHash returns the public key hash paid to by a pay-to-pubkey-hash scriptPubKey
+func extractPubKeyHash(script []byte) ([]byte, bool) {
+	if len(script) != 25 || Opcode(script[0]) != OP_DUP || Opcode(script[1]) != OP_HASH160 ||
+		script[2] != 20 || Opcode(script[23]) != OP_EQUALVERIFY || Opcode(script[24]) != OP_CHECKSIG {
+		return nil, false
+	}
+	return bytes.Clone(script[3:23]), true
+}
+
+// PayToScriptHashScript returns the standard pay-to-script-hash scriptPubKey:
+// OP_HASH160 <scriptHash> OP_EQUAL
+func PayToScriptHashScript(scriptHash []byte) []byte {
+	var b ScriptBuilder
+	return b.AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// extractScriptHash returns the script hash paid to by a pay-to-script-hash scriptPubKey
+func extractScriptHash(script []byte) ([]byte, bool) {
+	if len(script) != 23 || Opcode(script[0]) != OP_HASH160 || script[1] != 20 || Opcode(script[22]) != OP_EQUAL {
+		return nil, false
+	}
+	return bytes.Clone(script[2:22]), true
+}
+
+// MultisigScript returns the script requiring m signatures of the given public keys:
+// OP_m <pubKey1> ... <pubKeyN> OP_n OP_CHECKMULTISIG
+func MultisigScript(m int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) < 1 || len(pubKeys) > MaxPubKeysPerMultisig {
+		return nil, ErrInvalidPubKeyCount
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, ErrInvalidSigCount
+	}
+
+	var b ScriptBuilder
+	b.AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	return b.AddInt(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script(), nil
+}
+
+// AddressToScriptPubKey returns the hex encoded scriptPubKey paying to address
+func AddressToScriptPubKey(address string) (string, error) {
+	if scriptHash, err := AddressToScriptHash(address); err == nil {
+		return hex.EncodeToString(PayToScriptHashScript(scriptHash)), nil
+	}
+	pubKeyHash, err := AddressToPubKeyHash(address)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(PayToPubKeyHashScript(pubKeyHash)), nil
+}
+
+// ScriptPubKeyToAddress returns the address a hex encoded scriptPubKey pays to.
+// It fails for scripts that do not follow a standard template.
+func ScriptPubKeyToAddress(scriptPubKey string) (string, error) {
+	script, err := hex.DecodeString(scriptPubKey)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding scriptPubKey hex: %v", err)
+	}
+	if pubKeyHash, ok := extractPubKeyHash(script); ok {
+		return PubKeyHashToAddress(pubKeyHash), nil
+	}
+	if scriptHash, ok := extractScriptHash(script); ok {
+		return ScriptHashToAddress(scriptHash), nil
+	}
+	return "", errors.New("scriptPubKey is not a standard template")
+}
+
+// MaxDataCarrierSize is the maximum number of bytes a data carrier output can hold
+const MaxDataCarrierSize = 80
+
+// NullDataScript returns the scriptPubKey of a data carrier output: OP_RETURN <data>.
+// Executing it fails right away, so the output is provably unspendable.
+func NullDataScript(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data) > MaxDataCarrierSize {
+		return nil, fmt.Errorf("data carrier payload must hold 1 to %d bytes, got %d", MaxDataCarrierSize, len(data))
+	}
+	var b ScriptBuilder
+	return b.AddOp(OP_RETURN).AddData(data).Script(), nil
+}
+
+// extractNullData returns the payload of a data carrier scriptPubKey
+func extractNullData(script []byte) ([]byte, bool) {
+	if len(script) < 2 || Opcode(script[0]) != OP_RETURN {
+		return nil, false
+	}
+	ops, err := parseScript(script[1:])
+	if err != nil || len(ops) != 1 || ops[0].opcode < OP_DATA_1 || ops[0].opcode > OP_PUSHDATA2 {
+		return nil, false
+	}
+	if len(ops[0].data) == 0 || len(ops[0].data) > MaxDataCarrierSize {
+		return nil, false
+	}
+	return bytes.Clone(ops[0].data), true
+}
@@ -0,0 +1,172 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testChecker accepts a signature made of "sig:" followed by the public key,
+// and lock times up to the ones it holds
+type testChecker struct {
+	lockTime int64
+	sequence int64
+}
+
+func (c testChecker) checkSig(sig, pubKey []byte) bool {
+	return bytes.Equal(sig, append([]byte("sig:"), pubKey...))
+}
+
+func (c testChecker) checkLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) checkSequence(sequence int64) bool {
+	return sequence <= c.sequence
+}
+
+func testSig(pubKey string) []byte {
+	return []byte("sig:" + pubKey)
+}
+
+// script assembles a script from opcodes, byte slices pushed as data and ints pushed as numbers
+func script(parts ...any) []byte {
+	var b ScriptBuilder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case Opcode:
+			b.AddOp(p)
+		case []byte:
+			b.AddData(p)
+		case string:
+			b.AddData([]byte(p))
+		case int:
+			b.AddInt(int64(p))
+		}
+	}
+	return b.Script()
+}
+
+func TestVerifyScript(t *testing.T) {
+	pubKeyHash := hash160([]byte("key"))
+	redeemScript := script(2, "a", "b", "c", 3, OP_CHECKMULTISIG)
+	p2sh := PayToScriptHashScript(hash160(redeemScript))
+	checker := testChecker{lockTime: 100, sequence: 10}
+
+	tests := []struct {
+		name         string
+		scriptSig    []byte
+		scriptPubKey []byte
+		err          error
+	}{
+		{"true", nil, script(OP_1), nil},
+		{"empty", nil, nil, ErrScriptFailed},
+		{"false", nil, script(OP_0), ErrScriptFailed},
+		{"negative zero is false", script([]byte{0x80}), nil, ErrScriptFailed},
+		{"equal", script("x"), script("x", OP_EQUAL), nil},
+		{"not equal", script("x"), script("y", OP_EQUAL), ErrScriptFailed},
+		{"equalverify", script("x"), script("y", OP_EQUALVERIFY, OP_1), ErrVerifyFailed},
+		{"drop and dup", script(OP_0, OP_1), script(OP_DUP, OP_DROP, OP_DROP), ErrScriptFailed},
+		{"underflow", nil, script(OP_DROP), ErrStackUnderflow},
+		{"return", script(OP_1), script(OP_RETURN, "data"), ErrEarlyReturn},
+		{"unknown opcode", nil, []byte{0xff}, ErrUnknownOpcode},
+		{"truncated push", nil, []byte{0x05, 0x01}, ErrMalformedPush},
+		{"truncated pushdata2", nil, []byte{byte(OP_PUSHDATA2), 0x01}, ErrMalformedPush},
+		{"element too large", script(make([]byte, MaxScriptElementSize+1)), script(OP_1), ErrScriptElementTooLarge},
+		{"script too large", nil, make([]byte, MaxScriptSize+1), ErrScriptTooLarge},
+		{"too many ops", nil, append(bytes.Repeat([]byte{byte(OP_1), byte(OP_DROP)}, MaxOpsPerScript+1), byte(OP_1)), ErrTooManyOps},
+		{"stack overflow", nil, append(bytes.Repeat([]byte{byte(OP_1)}, MaxStackSize), byte(OP_1)), ErrStackOverflow},
+		{"scriptSig not push only", script(OP_1, OP_DUP), script(OP_1), ErrScriptSigNotPushOnly},
+		{"sha256", script("abc"), script(OP_SHA256, []byte{
+			0xba, 0x78, 0x16, 0xbf, 0x8f, 0x01, 0xcf, 0xea, 0x41, 0x41, 0x40, 0xde, 0x5d, 0xae, 0x22, 0x23,
+			0xb0, 0x03, 0x61, 0xa3, 0x96, 0x17, 0x7a, 0x9c, 0xb4, 0x10, 0xff, 0x61, 0xf2, 0x00, 0x15, 0xad,
+		}, OP_EQUAL), nil},
+		{"pay to pubkey hash", script(testSig("key"), "key"), PayToPubKeyHashScript(pubKeyHash), nil},
+		{"pay to pubkey hash wrong key", script(testSig("other"), "other"), PayToPubKeyHashScript(pubKeyHash), ErrVerifyFailed},
+		{"pay to pubkey hash wrong signature", script(testSig("other"), "key"), PayToPubKeyHashScript(pubKeyHash), ErrScriptFailed},
+		{"checksigverify", script(testSig("key")), script("key", OP_CHECKSIGVERIFY, OP_1), nil},
+		{"multisig", script(testSig("a"), testSig("c")), script(2, "a", "b", "c", 3, OP_CHECKMULTISIG), nil},
+		{"multisig out of order", script(testSig("c"), testSig("a")), script(2, "a", "b", "c", 3, OP_CHECKMULTISIG), ErrScriptFailed},
+		{"multisig same key twice", script(testSig("a"), testSig("a")), script(2, "a", "b", "c", 3, OP_CHECKMULTISIG), ErrScriptFailed},
+		{"multisig too few signatures", script(testSig("a")), script(2, "a", "b", "c", 3, OP_CHECKMULTISIG), ErrStackUnderflow},
+		{"multisig more signatures than keys", script(testSig("a"), testSig("b")), script(2, "a", 1, OP_CHECKMULTISIG), ErrInvalidSigCount},
+		{"multisig no keys", nil, script(0, 0, OP_CHECKMULTISIG), ErrInvalidPubKeyCount},
+		{"pay to script hash", script(testSig("a"), testSig("b"), redeemScript), p2sh, nil},
+		{"pay to script hash failing redeem script", script(testSig("a"), redeemScript), p2sh, ErrStackUnderflow},
+		{"pay to script hash wrong redeem script", script(testSig("a"), testSig("b"), script(OP_1)), p2sh, ErrScriptFailed},
+		{"checklocktimeverify", script(100), script(OP_CHECKLOCKTIMEVERIFY), nil},
+		{"checklocktimeverify unsatisfied", script(101), script(OP_CHECKLOCKTIMEVERIFY), ErrUnsatisfiedLockTime},
+		{"checklocktimeverify negative", script(-1), script(OP_CHECKLOCKTIMEVERIFY), ErrNegativeLockTime},
+		{"checksequenceverify", script(10), script(OP_CHECKSEQUENCEVERIFY), nil},
+		{"checksequenceverify unsatisfied", script(11), script(OP_CHECKSEQUENCEVERIFY), ErrUnsatisfiedLockTime},
+		{"checksequenceverify disabled", script(int(SequenceLockTimeDisableFlag) | 11), script(OP_CHECKSEQUENCEVERIFY), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyScript(tt.scriptSig, tt.scriptPubKey, checker)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("VerifyScript() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScriptNum(t *testing.T) {
+	tests := []struct {
+		v    int64
+		data []byte
+	}{
+		{0, nil},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{255, []byte{0xff, 0x00}},
+		{256, []byte{0x00, 0x01}},
+		{-32768, []byte{0x00, 0x80, 0x80}},
+		{1<<31 - 1, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+
+	for _, tt := range tests {
+		if got := encodeScriptNum(tt.v); !bytes.Equal(got, tt.data) {
+			t.Errorf("encodeScriptNum(%d) = %x, want %x", tt.v, got, tt.data)
+		}
+		if got, err := decodeScriptNum(tt.data, maxScriptNumLen); err != nil || got != tt.v {
+			t.Errorf("decodeScriptNum(%x) = %d, %v, want %d", tt.data, got, err, tt.v)
+		}
+	}
+
+	for _, data := range [][]byte{{0x00}, {0x80}, {0x01, 0x00}, {0x01, 0x80}, {0x01, 0x02, 0x03, 0x04, 0x05}} {
+		if _, err := decodeScriptNum(data, maxScriptNumLen); !errors.Is(err, ErrInvalidScriptNum) {
+			t.Errorf("decodeScriptNum(%x) = %v, want %v", data, err, ErrInvalidScriptNum)
+		}
+	}
+}
+
+func TestScriptBuilderPushes(t *testing.T) {
+	tests := []struct {
+		size   int
+		prefix []byte
+	}{
+		{0, []byte{byte(OP_0)}},
+		{1, []byte{0x01}},
+		{75, []byte{0x4b}},
+		{76, []byte{byte(OP_PUSHDATA1), 76}},
+		{255, []byte{byte(OP_PUSHDATA1), 0xff}},
+		{256, []byte{byte(OP_PUSHDATA2), 0x00, 0x01}},
+	}
+
+	for _, tt := range tests {
+		data := bytes.Repeat([]byte{0xab}, tt.size)
+		s := script(data)
+		if !bytes.HasPrefix(s, tt.prefix) || len(s) != len(tt.prefix)+tt.size {
+			t.Errorf("push of %d bytes = %x..., want prefix %x", tt.size, s[:min(len(s), 3)], tt.prefix)
+		}
+		ops, err := parseScript(s)
+		if err != nil || len(ops) != 1 || !bytes.Equal(ops[0].data, data) && tt.size > 0 {
+			t.Errorf("parseScript(push of %d bytes) = %v, %v", tt.size, ops, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// SigHashType selects the parts of a transaction a signature commits to.
+// It is appended to the signature as a single byte.
+type SigHashType byte
+
+const (
+	SigHashAll    SigHashType = 0x01 // sign every input and every output
+	SigHashNone   SigHashType = 0x02 // sign every input but none of the outputs
+	SigHashSingle SigHashType = 0x03 // sign every input and the output with the index of the signed input
+
+	// SigHashAnyOneCanPay can be combined with the types above to sign only the signed input,
+	// letting others add inputs of their own
+	SigHashAnyOneCanPay SigHashType = 0x80
+
+	sigHashBaseMask = 0x1f
+)
+
+var (
+	ErrInvalidSigHashType = errors.New("invalid signature hash type")
+	ErrSigHashSingleIndex = errors.New("SIGHASH_SINGLE input has no output with the same index")
+)
+
+func (t SigHashType) base() SigHashType {
+	return t & sigHashBaseMask
+}
+
+func (t SigHashType) anyoneCanPay() bool {
+	return t&SigHashAnyOneCanPay != 0
+}
+
+// isValid reports whether t is one of the defined types, optionally combined with SigHashAnyOneCanPay
+func (t SigHashType) isValid() bool {
+	if t&^(SigHashAnyOneCanPay|sigHashBaseMask) != 0 {
+		return false
+	}
+	base := t.base()
+	return base >= SigHashAll && base <= SigHashSingle
+}
+
+// SignatureHash returns the digest signed by input index, which spends the output spent.
+// The digest commits to ChainID, so signatures cannot be replayed on other chains, to the index
+// of the input and to the value and scriptPubKey of the spent output. Which other inputs and
+// outputs of the transaction it covers is selected by hashType:
+//
+//   - SigHashAll covers every output.
+//   - SigHashNone covers no output, and the sequence numbers of the other inputs are left out,
+//     so their signers can replace them.
+//   - SigHashSingle covers only the output with the same index as the input. The outputs
+//     before it are kept as empty placeholders, and the other sequence numbers are left out.
+//   - SigHashAnyOneCanPay covers only the signed input instead of every input.
+//
+// The scriptSigs are never covered, as they carry the signatures.
+func (tx *Transaction) SignatureHash(index int, spent UTXO, hashType SigHashType) ([]byte, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return nil, fmt.Errorf("transaction has no input %d", index)
+	}
+	if !hashType.isValid() {
+		return nil, fmt.Errorf("%w: 0x%02x", ErrInvalidSigHashType, byte(hashType))
+	}
+	if hashType.base() == SigHashSingle && index >= len(tx.Outputs) {
+		return nil, ErrSigHashSingleIndex
+	}
+
+	var e encoder
+	e.writeUint32(ChainID)
+	e.writeUint32(tx.Version)
+	e.writeBool(tx.IsCoinbase)
+	e.writeString(tx.Sender)
+	e.writeString(tx.Recipent)
+	e.writeInt(tx.Amount)
+	e.writeInt64(tx.Timestamp)
+
+	inputs := tx.Inputs
+	if hashType.anyoneCanPay() {
+		inputs = tx.Inputs[index : index+1]
+	}
+	e.writeLen(len(inputs))
+	for i, input := range inputs {
+		e.writeString(input.PrevTxID)
+		e.writeInt(input.OutputIndex)
+		if hashType.base() != SigHashAll && !hashType.anyoneCanPay() && i != index {
+			e.writeUint32(0)
+		} else {
+			e.writeUint32(input.Sequence)
+		}
+	}
+
+	switch hashType.base() {
+	case SigHashAll:
+		e.writeLen(len(tx.Outputs))
+		for _, output := range tx.Outputs {
+			e.writeInt(output.Value)
+			e.writeString(output.ScriptPubKey)
+		}
+	case SigHashNone:
+		e.writeLen(0)
+	case SigHashSingle:
+		e.writeLen(index + 1)
+		for i := 0; i < index; i++ {
+			e.writeInt(-1)
+			e.writeString("")
+		}
+		e.writeInt(tx.Outputs[index].Value)
+		e.writeString(tx.Outputs[index].ScriptPubKey)
+	}
+	e.writeUint32(tx.LockTime)
+
+	e.writeUint32(uint32(index))
+	e.writeInt(spent.Value)
+	e.writeString(spent.ScriptPubKey)
+	e.writeUint32(uint32(hashType))
+
+	hash := sha256.Sum256(e.buf)
+	return hash[:], nil
+}
+
+// SignInput signs input index of the transaction, which spends the output spent, with privateKey.
+// It returns the signature followed by the hashType byte, which the caller places in the scriptSig
+// of the input. It also sets the transaction id.
+func (tx *Transaction) SignInput(index int, spent UTXO, hashType SigHashType, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	hash, err := tx.SignatureHash(index, spent, hashType)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxID = tx.calculateID()
+
+	sigBytes, err := ecdsa.SignASN1(rand.Reader, privateKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sigBytes, byte(hashType)), nil
+}
@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// newSigHashTestTx returns a transaction with two inputs and two outputs, and the output its first input spends
+func newSigHashTestTx() (*Transaction, UTXO) {
+	tx := newTestTx([]string{"aa", "bb"}, 10, 20)
+	tx.Inputs[0].Sequence = 5
+	tx.Inputs[1].Sequence = 6
+	return tx, UTXO{TxID: "aa", Value: 40, ScriptPubKey: "51"}
+}
+
+func TestSignatureHashCoverage(t *testing.T) {
+	types := []SigHashType{
+		SigHashAll,
+		SigHashNone,
+		SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay,
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(tx *Transaction, spent *UTXO)
+		covered [6]bool // whether the mutation changes the hash, per type in the order of types
+	}{
+		{"signed output", func(tx *Transaction, _ *UTXO) { tx.Outputs[0].Value++ },
+			[6]bool{true, false, true, true, false, true}},
+		{"other output", func(tx *Transaction, _ *UTXO) { tx.Outputs[1].Value++ },
+			[6]bool{true, false, false, true, false, false}},
+		{"added output", func(tx *Transaction, _ *UTXO) { tx.Outputs = append(tx.Outputs, Output{Value: 1, ScriptPubKey: "51"}) },
+			[6]bool{true, false, false, true, false, false}},
+		{"other input sequence", func(tx *Transaction, _ *UTXO) { tx.Inputs[1].Sequence++ },
+			[6]bool{true, false, false, false, false, false}},
+		{"other input outpoint", func(tx *Transaction, _ *UTXO) { tx.Inputs[1].OutputIndex++ },
+			[6]bool{true, true, true, false, false, false}},
+		{"added input", func(tx *Transaction, _ *UTXO) { tx.Inputs = append(tx.Inputs, Input{PrevTxID: "cc"}) },
+			[6]bool{true, true, true, false, false, false}},
+		{"signed input sequence", func(tx *Transaction, _ *UTXO) { tx.Inputs[0].Sequence++ },
+			[6]bool{true, true, true, true, true, true}},
+		{"lock time", func(tx *Transaction, _ *UTXO) { tx.LockTime++ },
+			[6]bool{true, true, true, true, true, true}},
+		{"spent value", func(_ *Transaction, spent *UTXO) { spent.Value++ },
+			[6]bool{true, true, true, true, true, true}},
+		{"spent scriptPubKey", func(_ *Transaction, spent *UTXO) { spent.ScriptPubKey = "52" },
+			[6]bool{true, true, true, true, true, true}},
+		{"scriptSigs", func(tx *Transaction, _ *UTXO) { tx.Inputs[0].ScriptSig = "51"; tx.Inputs[1].ScriptSig = "52" },
+			[6]bool{false, false, false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		for i, hashType := range types {
+			tx, spent := newSigHashTestTx()
+			before, err := tx.SignatureHash(0, spent, hashType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.mutate(tx, &spent)
+			after, err := tx.SignatureHash(0, spent, hashType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := !bytes.Equal(before, after); changed != tt.covered[i] {
+				t.Errorf("%s with hash type %#02x: hash changed = %v, want %v", tt.name, byte(hashType), changed, tt.covered[i])
+			}
+		}
+	}
+}
+
+func TestSignatureHashDistinctTypes(t *testing.T) {
+	tx, spent := newSigHashTestTx()
+	seen := make(map[string]SigHashType)
+	for _, hashType := range []SigHashType{SigHashAll, SigHashNone, SigHashSingle, SigHashAll | SigHashAnyOneCanPay} {
+		hash, err := tx.SignatureHash(0, spent, hashType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, exists := seen[string(hash)]; exists {
+			t.Fatalf("hash types %#02x and %#02x sign the same hash", byte(other), byte(hashType))
+		}
+		seen[string(hash)] = hashType
+	}
+}
+
+func TestSignatureHashInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		index    int
+		hashType SigHashType
+		err      error
+	}{
+		{"undefined type", 0, 0x00, ErrInvalidSigHashType},
+		{"type above single", 0, 0x04, ErrInvalidSigHashType},
+		{"unknown flag", 0, SigHashAll | 0x40, ErrInvalidSigHashType},
+		{"anyonecanpay alone", 0, SigHashAnyOneCanPay, ErrInvalidSigHashType},
+		{"single without output", 2, SigHashSingle, ErrSigHashSingleIndex},
+		{"missing input", 3, SigHashAll, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, spent := newSigHashTestTx()
+			tx.Inputs = append(tx.Inputs, Input{PrevTxID: "cc"})
+			_, err := tx.SignatureHash(tt.index, spent, tt.hashType)
+			if err == nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("SignatureHash() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSignInputHashTypes(t *testing.T) {
+	wallet := newTestWallet(t)
+	key, err := wallet.key(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := elliptic.Marshal(elliptic.P256(), key.PublicKey.X, key.PublicKey.Y)
+	script, err := AddressToScriptPubKey(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hashType SigHashType
+		mutate   func(tx *Transaction)
+		ok       bool
+	}{
+		{"all", SigHashAll, func(tx *Transaction) {}, true},
+		{"all with changed output", SigHashAll, func(tx *Transaction) { tx.Outputs[1].Value++ }, false},
+		{"single with changed other output", SigHashSingle, func(tx *Transaction) { tx.Outputs[1].Value++ }, true},
+		{"single with changed signed output", SigHashSingle, func(tx *Transaction) { tx.Outputs[0].Value++ }, false},
+		{"none with changed outputs", SigHashNone, func(tx *Transaction) { tx.Outputs = tx.Outputs[:1] }, true},
+		{"anyonecanpay with added input", SigHashAll | SigHashAnyOneCanPay, func(tx *Transaction) {
+			tx.Inputs = append(tx.Inputs, Input{PrevTxID: "cc", Sequence: MaxSequence})
+		}, true},
+		{"all with added input", SigHashAll, func(tx *Transaction) {
+			tx.Inputs = append(tx.Inputs, Input{PrevTxID: "cc", Sequence: MaxSequence})
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, spent := newSigHashTestTx()
+			spent.ScriptPubKey = script
+			sig, err := tx.SignInput(0, spent, tt.hashType, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if SigHashType(sig[len(sig)-1]) != tt.hashType {
+				t.Fatalf("signature ends with hash type %#02x, want %#02x", sig[len(sig)-1], byte(tt.hashType))
+			}
+			tx.Inputs[0].ScriptSig = hex.EncodeToString(CreateScriptSig(sig, pubKey))
+
+			tt.mutate(tx)
+			if err := UnlockUTXO(tx, 0, spent); (err == nil) != tt.ok {
+				t.Fatalf("UnlockUTXO() = %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/shu8h0-null/minbit/core/config"
 	bolt "go.etcd.io/bbolt"
@@ -16,9 +19,58 @@ import (
 type bucketName string
 
 const (
-	blockBucket   bucketName = "blocks"
-	utxoBucket    bucketName = "utxos"
+	blockBucket bucketName = "blocks"
+	utxoBucket  bucketName = "utxos"
+	metaBucket  bucketName = "meta"
+
+	// headerBucket maps the hash of every stored block to its header and height, which the block tree
+	// is loaded from, and heightBucket maps the height of every main chain block to its hash
+	headerBucket bucketName = "headers"
+	heightBucket bucketName = "heights"
+
+	// invalidBucket holds the hash of every stored block that failed validation while connecting it.
+	// The blocks descending from them are invalid as well, which is derived when loading the block tree.
+	invalidBucket bucketName = "invalid"
+
+	// undoBucket maps the hash of every block connected to the main chain to its undo record
+	undoBucket bucketName = "undo"
+
+	// txIndexBucket maps the id of every transaction on the main chain to its location
 	txIndexBucket bucketName = "txIndex"
+
+	// addrUTXOBucket and addrTxBucket make up the optional address index. addrUTXOBucket maps
+	// each address followed by an outpoint to the utxo paying to the address, and addrTxBucket
+	// maps each address followed by the height and position of a transaction on the main chain
+	// to the id of the transaction, which pays to or spends from the address.
+	addrUTXOBucket bucketName = "addrUTXOs"
+	addrTxBucket   bucketName = "addrTxs"
+
+	// dataIndexBucket maps the payload of every data carrier output on the main chain,
+	// followed by the id of its transaction, to the location of the output
+	dataIndexBucket bucketName = "dataIndex"
+)
+
+// StoreVersion is the version of the on-disk format of the store, bumped whenever stored
+// blocks or utxos change in a way older stores cannot be decoded or validated with.
+//
+// Version 1 encodes block and transaction timestamps as unix seconds. Stores without
+// a version predate it and hold string timestamps.
+// Version 2 locks outputs with scripts instead of bare public key hashes.
+// Version 3 adds lock times to transactions and sequence numbers to inputs.
+// Version 4 keeps data carrier outputs out of the utxo set and indexes them by payload.
+// Version 5 signs each input with its own signature hash, which signatures of older chains do not verify against.
+const StoreVersion = 5
+
+var (
+	storeVersionKey = []byte("version")
+	addrIndexKey    = []byte("addrindex") // set once the address index is built
+)
+
+var (
+	ErrLegacyStore = errors.New("store was written in an older format")
+	ErrTxNotFound  = errors.New("transaction not found in main chain")
+	ErrNoAddrIndex = errors.New("address index is not enabled")
+	ErrNoUndo      = errors.New("undo record not found")
 )
 
 type Store struct {
@@ -44,9 +96,10 @@ func NewDb(id string) (*Store, error) {
 	}
 
 	store := &Store{
-		db:          db,
-		blockBucket: blockBucket,
-		utxoBucket:  utxoBucket,
+		db:            db,
+		blockBucket:   blockBucket,
+		utxoBucket:    utxoBucket,
+		txIndexBucket: txIndexBucket,
 	}
 
 	return store, nil
@@ -91,6 +144,99 @@ func (store *Store) CreateTxIndexBucket() error {
 	return err
 }
 
+// Creates buckets for block headers, main chain heights and invalid blocks if not already exists
+// with names "headers", "heights" and "invalid"
+func (store *Store) CreateHeaderBuckets() error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []bucketName{headerBucket, heightBucket, invalidBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("Error creating bucket for %s %v", name, err)
+			}
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Creates a bucket for undo records if not already exists with name "undo"
+func (store *Store) CreateUndoBucket() error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(undoBucket))
+		if err != nil {
+			return fmt.Errorf("Error creating bucket for undo records %v", err)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Creates a bucket for the data carrier index if not already exists with name "dataIndex"
+func (store *Store) CreateDataIndexBucket() error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(dataIndexBucket))
+		if err != nil {
+			return fmt.Errorf("Error creating bucket for DataIndex %v", err)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// CheckVersion compares the format version recorded in the store with StoreVersion.
+// A store without any blocks is stamped with the current version. It returns ErrLegacyStore
+// if the store holds data written in an older format.
+func (store *Store) CheckVersion() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+		if err != nil {
+			return fmt.Errorf("Error creating bucket for store metadata %v", err)
+		}
+
+		if v := meta.Get(storeVersionKey); v != nil {
+			version, err := strconv.Atoi(string(v))
+			if err != nil {
+				return fmt.Errorf("invalid store version %q: %v", v, err)
+			}
+			if version < StoreVersion {
+				return fmt.Errorf("%w: version %d, expected %d", ErrLegacyStore, version, StoreVersion)
+			}
+			if version > StoreVersion {
+				return fmt.Errorf("store version %d is newer than supported version %d", version, StoreVersion)
+			}
+			return nil
+		}
+
+		if b := tx.Bucket([]byte(blockBucket)); b != nil {
+			if k, _ := b.Cursor().First(); k != nil {
+				return fmt.Errorf("%w: no version recorded", ErrLegacyStore)
+			}
+		}
+		return meta.Put(storeVersionKey, []byte(strconv.Itoa(StoreVersion)))
+	})
+}
+
+// Archive closes the store and moves its database file aside, so that a fresh store
+// can be created in its place. It returns the path the database was moved to.
+//
+// Block hashes and transaction ids commit to the encoding of their timestamps, so blocks of a
+// legacy store cannot be converted without changing their identity. Legacy stores are archived
+// instead, and the chain is synced again from peers.
+func (store *Store) Archive() (string, error) {
+	path := store.db.Path()
+	if err := store.Close(); err != nil {
+		return "", err
+	}
+
+	archived := fmt.Sprintf("%s.legacy-%d", path, time.Now().Unix())
+	if err := os.Rename(path, archived); err != nil {
+		return "", fmt.Errorf("failed to archive store: %w", err)
+	}
+	return archived, nil
+}
+
 func (store *Store) Db() *bolt.DB {
 	return store.db
 }
@@ -103,90 +249,833 @@ func (store *Store) UTXOSetBucket() bucketName {
 	return store.utxoBucket
 }
 
-func (store *Store) LoadBlocksFromTip() ([]*Block, error) {
-	var blocks []*Block
+// WriteBlock writes the block to the db and makes it the tip
+func (store *Store) WriteBlock(block *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := store.putBlock(tx, block); err != nil {
+			return err
+		}
+		return store.putTip(tx, block.Hash)
+	})
+}
 
+// StoreBlock writes the block to the db without moving the tip
+func (store *Store) StoreBlock(block *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.putBlock(tx, block)
+	})
+}
+
+// WriteTip points the tip of the chain to the block with the given hash.
+// An empty hash clears the tip.
+func (store *Store) WriteTip(hash string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.putTip(tx, hash)
+	})
+}
+
+func (store *Store) putBlock(tx *bolt.Tx, block *Block) error {
+	bucket := tx.Bucket([]byte(store.blockBucket))
+	if bucket == nil {
+		return errors.New("block bucket not found")
+	}
+	headers := tx.Bucket([]byte(headerBucket))
+	if headers == nil {
+		return errors.New("header bucket not found")
+	}
+
+	data, err := serializeBlock(*block)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Put([]byte(block.Hash), data); err != nil {
+		return err
+	}
+	return headers.Put([]byte(block.Hash), block.SerializeHeaderEntry())
+}
+
+// heightKey returns the key of the main chain block at height, which sorts by height
+func heightKey(height uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, height)
+}
+
+// TipHash reads the hash of the tip of the main chain, which is empty if the chain is empty
+func (store *Store) TipHash() (string, error) {
+	var tip string
 	err := store.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(store.blockBucket))
 		if bucket == nil {
-			return errors.New("bucket not found")
+			return errors.New("block bucket not found")
+		}
+		tip = string(bucket.Get([]byte("tip")))
+		return nil
+	})
+	return tip, err
+}
+
+// GetHashByHeight reads the hash of the main chain block at height
+func (store *Store) GetHashByHeight(height uint64) (string, error) {
+	var hash string
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(heightBucket))
+		if bucket == nil {
+			return errors.New("height bucket not found")
+		}
+
+		v := bucket.Get(heightKey(height))
+		if v == nil {
+			return fmt.Errorf("no main chain block at height %d", height)
+		}
+		hash = string(v)
+		return nil
+	})
+	return hash, err
+}
+
+// LoadHeaders loads the headers of every stored block, including those not on the main chain,
+// as blocks without transactions
+func (store *Store) LoadHeaders() ([]*Block, error) {
+	var blocks []*Block
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(headerBucket))
+		if bucket == nil {
+			return errors.New("header bucket not found")
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			block, err := DeserializeHeaderEntry(v)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
+			return nil
+		})
+	})
+
+	return blocks, err
+}
+
+// WriteInvalid records the block with the given hash as invalid
+func (store *Store) WriteInvalid(hash string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(invalidBucket))
+		if bucket == nil {
+			return errors.New("invalid block bucket not found")
 		}
+		return bucket.Put([]byte(hash), []byte{})
+	})
+}
 
-		tip := bucket.Get([]byte("tip"))
-		if tip == nil {
+// LoadInvalid reads the hashes of the blocks recorded as invalid
+func (store *Store) LoadInvalid() (map[string]bool, error) {
+	invalid := make(map[string]bool)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(invalidBucket))
+		if bucket == nil {
+			return errors.New("invalid block bucket not found")
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			invalid[string(k)] = true
+			return nil
+		})
+	})
+	return invalid, err
+}
+
+// IndexHeaders fills the header and height buckets from the stored blocks, for stores written
+// before they were kept. It does nothing if the headers are indexed already.
+func (store *Store) IndexHeaders() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(store.blockBucket))
+		headers := tx.Bucket([]byte(headerBucket))
+		heights := tx.Bucket([]byte(heightBucket))
+		if blocks == nil || headers == nil || heights == nil {
+			return errors.New("block, header or height bucket not found")
+		}
+
+		tip := blocks.Get([]byte("tip"))
+		if k, _ := headers.Cursor().First(); k != nil || tip == nil {
 			return nil
 		}
 
-		hash := tip
-		for hash != nil && len(hash) > 0 {
-			blockBytes := bucket.Get(hash)
-			block, err := deserializeBlock(blockBytes)
+		log.Info("Indexing headers of stored blocks")
+		err := blocks.ForEach(func(k, v []byte) error {
+			if string(k) == "tip" {
+				return nil
+			}
+			block, err := DeserializeBlock(v)
 			if err != nil {
 				return err
 			}
-			blocks = append(blocks, &block)
-			if block.PrevHash == "" {
-				break
+			return headers.Put(k, block.SerializeHeaderEntry())
+		})
+		if err != nil {
+			return err
+		}
+
+		for hash := tip; len(hash) > 0; {
+			v := headers.Get(hash)
+			if v == nil {
+				return fmt.Errorf("main chain block:[%s] not found", hash)
+			}
+			block, err := DeserializeHeaderEntry(v)
+			if err != nil {
+				return err
+			}
+			if err := heights.Put(heightKey(block.Height), hash); err != nil {
+				return err
 			}
 			hash = []byte(block.PrevHash)
 		}
 		return nil
 	})
+}
 
-	// Reverse to get correct order
-	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
-		blocks[i], blocks[j] = blocks[j], blocks[i]
+func (store *Store) putTip(tx *bolt.Tx, hash string) error {
+	bucket := tx.Bucket([]byte(store.blockBucket))
+	if bucket == nil {
+		return errors.New("block bucket not found")
 	}
 
-	return blocks, err
+	if hash == "" {
+		return bucket.Delete([]byte("tip"))
+	}
+	return bucket.Put([]byte("tip"), []byte(hash))
 }
 
-func (store *Store) WriteBlock(block *Block) error {
+// ConnectBlock makes block b the tip of the main chain in a single db transaction, which writes b
+// along with its changes to the utxo set, its undo record and its index entries, so that a failure
+// leaves none of them written. spent holds the outputs spent by b in the order of their inputs.
+// The address index is written only if addrIndex is set.
+func (store *Store) ConnectBlock(b *Block, spent []UTXO, addrIndex bool) error {
 	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := store.putBlock(tx, b); err != nil {
+			return err
+		}
+		if err := store.putTip(tx, b.Hash); err != nil {
+			return err
+		}
+		heights := tx.Bucket([]byte(heightBucket))
+		if heights == nil {
+			return errors.New("height bucket not found")
+		}
+		if err := heights.Put(heightKey(b.Height), []byte(b.Hash)); err != nil {
+			return err
+		}
+		for _, transaction := range b.TxData {
+			if err := store.writeUTXOs(tx, transaction, b.Height); err != nil {
+				return err
+			}
+		}
+		if err := putUndo(tx, b.Hash, &BlockUndo{Spent: spent}); err != nil {
+			return err
+		}
+		if err := store.writeTxIndex(tx, b); err != nil {
+			return err
+		}
+		if err := writeDataIndex(tx, b); err != nil {
+			return err
+		}
+		if addrIndex {
+			return writeAddrIndex(tx, b, spent)
+		}
+		return nil
+	})
+}
+
+// GetBlock reads the block with the given hash from the db
+func (store *Store) GetBlock(hash string) (*Block, error) {
+	var block Block
+
+	err := store.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(store.blockBucket))
 		if bucket == nil {
 			return errors.New("block bucket not found")
 		}
 
-		data, err := serializeBlock(*block)
+		blockBytes := bucket.Get([]byte(hash))
+		if blockBytes == nil {
+			return fmt.Errorf("block:[%s] not found", hash)
+		}
+
+		var err error
+		block, err = deserializeBlock(blockBytes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+// WriteUpdate writes the changes to the db by deleting spent outputs and adding new ones with the provided transaction
+// Returns an error if any database operation fails.
+func (store *Store) WriteUTXOs(transaction Transaction, height uint64) error {
+	return store.Db().Update(func(tx *bolt.Tx) error {
+		return store.writeUTXOs(tx, transaction, height)
+	})
+}
+
+func (store *Store) writeUTXOs(tx *bolt.Tx, transaction Transaction, height uint64) error {
+	b := tx.Bucket([]byte(store.UTXOSetBucket()))
+	if b == nil {
+		return errors.New("utxo bucket not found")
+	}
+	for _, input := range transaction.SpentInputs() {
+		k := input.PrevTxID + "_" + strconv.Itoa(input.OutputIndex)
+		if err := b.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, utxo := range transaction.UTXOs(height) {
+		k := utxo.TxID + "_" + strconv.Itoa(utxo.OutputIndex)
+		v, err := serializeUTXO(utxo)
 		if err != nil {
 			return err
 		}
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevertUTXOs undoes WriteUTXOs for the provided transaction by deleting its outputs
+// and restoring the outputs it spent
+func (store *Store) RevertUTXOs(transaction Transaction, spent []UTXO) error {
+	return store.Db().Update(func(tx *bolt.Tx) error {
+		return store.revertUTXOs(tx, transaction, spent)
+	})
+}
+
+func (store *Store) revertUTXOs(tx *bolt.Tx, transaction Transaction, spent []UTXO) error {
+	b := tx.Bucket([]byte(store.UTXOSetBucket()))
+	if b == nil {
+		return errors.New("utxo bucket not found")
+	}
+	for _, utxo := range transaction.UTXOs(0) {
+		k := utxo.TxID + "_" + strconv.Itoa(utxo.OutputIndex)
+		if err := b.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, utxo := range spent {
+		k := utxo.TxID + "_" + strconv.Itoa(utxo.OutputIndex)
+		v, err := serializeUTXO(utxo)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock makes the parent of block b, the tip of the main chain, the new tip in a single
+// db transaction, which undoes the changes of b to the utxo set with its undo record and removes
+// its undo record and index entries. b stays stored as part of the block tree. The address index
+// is updated only if addrIndex is set.
+func (store *Store) DisconnectBlock(b *Block, undo *BlockUndo, addrIndex bool) error {
+	spentByTx, err := splitSpent(b, undo.Spent)
+	if err != nil {
+		return err
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for i := len(b.TxData) - 1; i >= 0; i-- {
+			if err := store.revertUTXOs(tx, b.TxData[i], spentByTx[i]); err != nil {
+				return err
+			}
+		}
+		if err := store.removeTxIndex(tx, b); err != nil {
+			return err
+		}
+		if err := removeDataIndex(tx, b); err != nil {
+			return err
+		}
+		if addrIndex {
+			if err := removeAddrIndex(tx, b, undo.Spent); err != nil {
+				return err
+			}
+		}
+
+		bucket := tx.Bucket([]byte(undoBucket))
+		if bucket == nil {
+			return errors.New("undo bucket not found")
+		}
+		if err := bucket.Delete([]byte(b.Hash)); err != nil {
+			return err
+		}
+		heights := tx.Bucket([]byte(heightBucket))
+		if heights == nil {
+			return errors.New("height bucket not found")
+		}
+		if err := heights.Delete(heightKey(b.Height)); err != nil {
+			return err
+		}
+		return store.putTip(tx, b.PrevHash)
+	})
+}
+
+func putUndo(tx *bolt.Tx, hash string, undo *BlockUndo) error {
+	bucket := tx.Bucket([]byte(undoBucket))
+	if bucket == nil {
+		return errors.New("undo bucket not found")
+	}
+	return bucket.Put([]byte(hash), undo.Serialize())
+}
+
+// GetBlockUndo reads the undo record of the main chain block with the given hash.
+// It returns ErrNoUndo if the block was connected before undo records were kept.
+func (store *Store) GetBlockUndo(hash string) (*BlockUndo, error) {
+	var undo *BlockUndo
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(undoBucket))
+		if bucket == nil {
+			return errors.New("undo bucket not found")
+		}
+
+		v := bucket.Get([]byte(hash))
+		if v == nil {
+			return fmt.Errorf("%w: block:[%s]", ErrNoUndo, hash)
+		}
+
+		var err error
+		undo, err = DeserializeBlockUndo(v)
+		return err
+	})
+	return undo, err
+}
+
+// WriteTxIndex indexes the transactions of block b by id
+func (store *Store) WriteTxIndex(b *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.writeTxIndex(tx, b)
+	})
+}
+
+func (store *Store) writeTxIndex(tx *bolt.Tx, b *Block) error {
+	bucket := tx.Bucket([]byte(store.txIndexBucket))
+	if bucket == nil {
+		return errors.New("tx index bucket not found")
+	}
 
-		if err := bucket.Put([]byte(block.Hash), data); err != nil {
+	for i, transaction := range b.TxData {
+		loc := TxLocation{BlockHash: b.Hash, Position: i}
+		if err := bucket.Put([]byte(transaction.TxID), loc.Serialize()); err != nil {
 			return err
 		}
-		if err := bucket.Put([]byte("tip"), []byte(block.Hash)); err != nil {
+	}
+	return nil
+}
+
+// RemoveTxIndex undoes WriteTxIndex for block b
+func (store *Store) RemoveTxIndex(b *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return store.removeTxIndex(tx, b)
+	})
+}
+
+func (store *Store) removeTxIndex(tx *bolt.Tx, b *Block) error {
+	bucket := tx.Bucket([]byte(store.txIndexBucket))
+	if bucket == nil {
+		return errors.New("tx index bucket not found")
+	}
+
+	for _, transaction := range b.TxData {
+		if err := bucket.Delete([]byte(transaction.TxID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTxLocation returns the location of the transaction with id txID on the main chain.
+// It returns ErrTxNotFound if the transaction is not indexed.
+func (store *Store) GetTxLocation(txID string) (*TxLocation, error) {
+	var loc *TxLocation
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(store.txIndexBucket))
+		if bucket == nil {
+			return errors.New("tx index bucket not found")
+		}
+
+		v := bucket.Get([]byte(txID))
+		if v == nil {
+			return fmt.Errorf("%w: %s", ErrTxNotFound, txID)
+		}
+
+		var err error
+		loc, err = DeserializeTxLocation(v)
+		return err
+	})
+	return loc, err
+}
+
+// addrUTXOKey returns the address index key of the utxo of address created by output index of transaction txID
+func addrUTXOKey(address, txID string, index int) []byte {
+	return []byte(address + "_" + outpoint(txID, index))
+}
+
+// addrTxKey returns the address index key of the transaction of address at position of the block at height.
+// Keys of an address sort by the order of the transactions on the chain.
+func addrTxKey(address string, height uint64, position int) []byte {
+	key := make([]byte, 0, len(address)+1+8+4)
+	key = append(key, address...)
+	key = append(key, '_')
+	key = binary.BigEndian.AppendUint64(key, height)
+	return binary.BigEndian.AppendUint32(key, uint32(position))
+}
+
+// addrPrefix returns the prefix of the address index keys of address.
+// Base58 addresses never contain the separator, so prefixes of distinct addresses do not overlap.
+func addrPrefix(address string) []byte {
+	return []byte(address + "_")
+}
+
+// utxoAddress returns the address the utxo pays to, if its script pays to an address
+func utxoAddress(utxo UTXO) (string, bool) {
+	address, err := ScriptPubKeyToAddress(utxo.ScriptPubKey)
+	return address, err == nil
+}
+
+// splitSpent splits the outputs spent by the transactions of block b, given in the order of
+// their inputs, by transaction
+func splitSpent(b *Block, spent []UTXO) ([][]UTXO, error) {
+	byTx := make([][]UTXO, len(b.TxData))
+	for i, transaction := range b.TxData {
+		n := len(transaction.SpentInputs())
+		if n > len(spent) {
+			return nil, fmt.Errorf("missing spent outputs of transaction:[%s]", transaction.TxID)
+		}
+		byTx[i], spent = spent[:n], spent[n:]
+	}
+	if len(spent) > 0 {
+		return nil, fmt.Errorf("%d spent outputs left over for block:[%s]", len(spent), b.Hash)
+	}
+	return byTx, nil
+}
+
+// addrIndexBuckets returns the buckets of the address index
+func addrIndexBuckets(tx *bolt.Tx) (*bolt.Bucket, *bolt.Bucket, error) {
+	utxos := tx.Bucket([]byte(addrUTXOBucket))
+	txs := tx.Bucket([]byte(addrTxBucket))
+	if utxos == nil || txs == nil {
+		return nil, nil, ErrNoAddrIndex
+	}
+	return utxos, txs, nil
+}
+
+// HasAddrIndex reports whether the address index was built
+func (store *Store) HasAddrIndex() (bool, error) {
+	var built bool
+	err := store.db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucket)); meta != nil {
+			built = meta.Get(addrIndexKey) != nil
+		}
+		return nil
+	})
+	return built, err
+}
+
+// ResetAddrIndex deletes the address index and creates its buckets empty. The index is not marked
+// built until MarkAddrIndex is called, so a store left without an index is not trusted to have one.
+func (store *Store) ResetAddrIndex() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if err := dropAddrIndex(tx); err != nil {
 			return err
 		}
+		for _, name := range []bucketName{addrUTXOBucket, addrTxBucket} {
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return fmt.Errorf("Error creating bucket for %s %v", name, err)
+			}
+		}
 		return nil
 	})
 }
 
-// WriteUpdate writes the changes to the db by deleting spent outputs and adding new ones with the provided transaction
-// Returns an error if any database operation fails.
-func (store *Store) WriteUTXOs(transaction Transaction) error {
-	err := store.Db().Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(store.UTXOSetBucket()))
-		for _, input := range transaction.Inputs {
-			k := input.PrevTxID + "_" + strconv.Itoa(input.OutputIndex)
-			if err := b.Delete([]byte(k)); err != nil {
+// DropAddrIndex deletes the address index, such as when it is no longer kept up to date
+func (store *Store) DropAddrIndex() error {
+	return store.db.Update(dropAddrIndex)
+}
+
+func dropAddrIndex(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return fmt.Errorf("Error creating bucket for store metadata %v", err)
+	}
+	if err := meta.Delete(addrIndexKey); err != nil {
+		return err
+	}
+	for _, name := range []bucketName{addrUTXOBucket, addrTxBucket} {
+		if err := tx.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkAddrIndex records that the address index is built
+func (store *Store) MarkAddrIndex() error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte(metaBucket))
+		if meta == nil {
+			return errors.New("meta bucket not found")
+		}
+		return meta.Put(addrIndexKey, []byte{1})
+	})
+}
+
+// WriteAddrIndex indexes the utxos and transactions of block b by address.
+// spent holds the outputs spent by the transactions of b, in the order of their inputs.
+func (store *Store) WriteAddrIndex(b *Block, spent []UTXO) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return writeAddrIndex(tx, b, spent)
+	})
+}
+
+func writeAddrIndex(tx *bolt.Tx, b *Block, spent []UTXO) error {
+	spentByTx, err := splitSpent(b, spent)
+	if err != nil {
+		return err
+	}
+	utxos, txs, err := addrIndexBuckets(tx)
+	if err != nil {
+		return err
+	}
+
+	for pos, transaction := range b.TxData {
+		txID := []byte(transaction.TxID)
+		for _, utxo := range spentByTx[pos] {
+			address, ok := utxoAddress(utxo)
+			if !ok {
+				continue
+			}
+			if err := utxos.Delete(addrUTXOKey(address, utxo.TxID, utxo.OutputIndex)); err != nil {
+				return err
+			}
+			if err := txs.Put(addrTxKey(address, b.Height, pos), txID); err != nil {
 				return err
 			}
 		}
 
-		for index, output := range transaction.Outputs {
-			var v bytes.Buffer
-			k := transaction.TxID + "_" + strconv.Itoa(index)
-			gob.NewEncoder(&v).Encode(output)
-			if err := b.Put([]byte(k), v.Bytes()); err != nil {
+		for _, utxo := range transaction.UTXOs(b.Height) {
+			address, ok := utxoAddress(utxo)
+			if !ok {
+				continue
+			}
+			if err := utxos.Put(addrUTXOKey(address, utxo.TxID, utxo.OutputIndex), utxo.Serialize()); err != nil {
+				return err
+			}
+			if err := txs.Put(addrTxKey(address, b.Height, pos), txID); err != nil {
 				return err
 			}
 		}
+	}
+	return nil
+}
+
+// RemoveAddrIndex undoes WriteAddrIndex for block b, walking its transactions in reverse order
+func (store *Store) RemoveAddrIndex(b *Block, spent []UTXO) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return removeAddrIndex(tx, b, spent)
+	})
+}
+
+func removeAddrIndex(tx *bolt.Tx, b *Block, spent []UTXO) error {
+	spentByTx, err := splitSpent(b, spent)
+	if err != nil {
+		return err
+	}
+	utxos, txs, err := addrIndexBuckets(tx)
+	if err != nil {
+		return err
+	}
+
+	for pos := len(b.TxData) - 1; pos >= 0; pos-- {
+		transaction := b.TxData[pos]
+		for _, utxo := range transaction.UTXOs(b.Height) {
+			address, ok := utxoAddress(utxo)
+			if !ok {
+				continue
+			}
+			if err := utxos.Delete(addrUTXOKey(address, utxo.TxID, utxo.OutputIndex)); err != nil {
+				return err
+			}
+			if err := txs.Delete(addrTxKey(address, b.Height, pos)); err != nil {
+				return err
+			}
+		}
+
+		for _, utxo := range spentByTx[pos] {
+			address, ok := utxoAddress(utxo)
+			if !ok {
+				continue
+			}
+			if err := utxos.Put(addrUTXOKey(address, utxo.TxID, utxo.OutputIndex), utxo.Serialize()); err != nil {
+				return err
+			}
+			if err := txs.Delete(addrTxKey(address, b.Height, pos)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddressUTXOs returns the utxos paying to address from the address index
+func (store *Store) AddressUTXOs(address string) ([]UTXO, error) {
+	var result []UTXO
+	err := store.db.View(func(tx *bolt.Tx) error {
+		utxos, _, err := addrIndexBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		prefix := addrPrefix(address)
+		c := utxos.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			utxo, err := DeserializeUTXO(v)
+			if err != nil {
+				return err
+			}
+			result = append(result, *utxo)
+		}
 		return nil
 	})
+	return result, err
+}
 
-	return err
+// AddressHistory returns the transactions of the main chain paying to or spending from address
+// from the address index, newest first. The first skip transactions are left out and at most
+// count are returned.
+func (store *Store) AddressHistory(address string, skip, count int) ([]AddressTx, error) {
+	if skip < 0 || count <= 0 {
+		return nil, errors.New("skip must not be negative and count must be positive")
+	}
+
+	var history []AddressTx
+	err := store.db.View(func(tx *bolt.Tx) error {
+		_, txs, err := addrIndexBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		prefix := addrPrefix(address)
+		c := txs.Cursor()
+		// the byte after the separator bounds the keys of the address
+		k, v := c.Seek(append([]byte(address), '_'+1))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(history) < count; k, v = c.Prev() {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			suffix := k[len(prefix):]
+			if len(suffix) != 8+4 {
+				return fmt.Errorf("invalid address index key %x", k)
+			}
+			history = append(history, AddressTx{
+				TxID:     string(v),
+				Height:   binary.BigEndian.Uint64(suffix),
+				Position: int(binary.BigEndian.Uint32(suffix[8:])),
+			})
+		}
+		return nil
+	})
+	return history, err
+}
+
+// txIDLen is the length of a hex encoded transaction id
+const txIDLen = 2 * sha256.Size
+
+// dataIndexKey returns the key of the data carrier output of transaction txID carrying the hex encoded payload
+func dataIndexKey(data, txID string) []byte {
+	return []byte(data + txID)
+}
+
+// WriteDataIndex indexes the data carrier outputs of the transactions of block b
+func (store *Store) WriteDataIndex(b *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return writeDataIndex(tx, b)
+	})
+}
+
+func writeDataIndex(tx *bolt.Tx, b *Block) error {
+	bucket := tx.Bucket([]byte(dataIndexBucket))
+	if bucket == nil {
+		return errors.New("data index bucket not found")
+	}
+
+	for _, record := range b.DataRecords() {
+		if err := bucket.Put(dataIndexKey(record.Data, record.TxID), record.Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveDataIndex undoes WriteDataIndex for block b
+func (store *Store) RemoveDataIndex(b *Block) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return removeDataIndex(tx, b)
+	})
+}
+
+func removeDataIndex(tx *bolt.Tx, b *Block) error {
+	bucket := tx.Bucket([]byte(dataIndexBucket))
+	if bucket == nil {
+		return errors.New("data index bucket not found")
+	}
+
+	for _, record := range b.DataRecords() {
+		if err := bucket.Delete(dataIndexKey(record.Data, record.TxID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindData returns the data carrier outputs on the main chain carrying payload
+func (store *Store) FindData(payload []byte) ([]DataRecord, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("data to look up must not be empty")
+	}
+
+	var records []DataRecord
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(dataIndexBucket))
+		if bucket == nil {
+			return errors.New("data index bucket not found")
+		}
+
+		prefix := []byte(hex.EncodeToString(payload))
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			// keys of longer payloads starting with the queried one share the prefix
+			if len(k) != len(prefix)+txIDLen {
+				continue
+			}
+			record, err := DeserializeDataRecord(v)
+			if err != nil {
+				return err
+			}
+			records = append(records, *record)
+		}
+		return nil
+	})
+
+	return records, err
 }
 
 func (store *Store) LoadUTXOs() (UTXOMap, error) {
@@ -200,17 +1089,15 @@ func (store *Store) LoadUTXOs() (UTXOMap, error) {
 
 		err := b.ForEach(func(k, v []byte) error {
 			u, err := deserializeUTXO(v)
+			if err != nil {
+				return err
+			}
 
 			if _, exists := umap[u.TxID]; !exists {
 				umap[u.TxID] = make(map[int]UTXO)
 			}
-			umap[u.TxID][u.OutputIndex] = UTXO{
-				TxID:         u.TxID,
-				OutputIndex:  u.OutputIndex,
-				Value:        u.Value,
-				ScriptPubKey: u.ScriptPubKey,
-			}
-			return err
+			umap[u.TxID][u.OutputIndex] = u
+			return nil
 		})
 
 		return err
@@ -227,37 +1114,37 @@ func (store *Store) Close() error {
 }
 
 func serializeBlock(b Block) ([]byte, error) {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(b)
-	return buf.Bytes(), err
+	return b.Serialize(), nil
 }
 
 func deserializeBlock(data []byte) (Block, error) {
-	var b Block
-	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&b)
-	return b, err
+	b, err := DeserializeBlock(data)
+	if err != nil {
+		return Block{}, err
+	}
+	return *b, nil
 }
 
 func serializeUTXO(u UTXO) ([]byte, error) {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(u)
-	return buf.Bytes(), err
+	return u.Serialize(), nil
 }
 
 func deserializeUTXO(data []byte) (UTXO, error) {
-	var u UTXO
-	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&u)
-	return u, err
+	u, err := DeserializeUTXO(data)
+	if err != nil {
+		return UTXO{}, err
+	}
+	return *u, nil
 }
 
 func serializeTx(tx Transaction) ([]byte, error) {
-	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(tx)
-	return buf.Bytes(), err
+	return tx.Serialize(), nil
 }
 
 func deserializeTx(data []byte) (Transaction, error) {
-	var tx Transaction
-	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tx)
-	return tx, err
+	tx, err := DeserializeTransaction(data)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return *tx, nil
 }
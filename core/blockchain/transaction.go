@@ -1,37 +1,26 @@
 package blockchain
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
-	"strconv"
-	"strings"
 
 	"github.com/mr-tron/base58/base58"
 )
 
+// TxVersion is the version of newly created transactions
+const TxVersion = 2
+
 type Transaction struct {
+	Version    uint32   `json:"version"`
 	TxID       string   `json:"transaction_id"`
 	Sender     string   `json:"sender"`
 	Recipent   string   `json:"recipent"`
 	Amount     int      `json:"amount"`
 	Inputs     []Input  `json:"inputs"`
 	Outputs    []Output `json:"outputs"`
-	Timestamps string   `json:"timestamps"`
+	Timestamp  int64    `json:"timestamp"` // unix time in seconds at which the transaction was created
 	IsCoinbase bool     `json:"is_coinbase"`
-}
-
-func (tx *Transaction) Sign(privateKey *ecdsa.PrivateKey) ([]byte, error) {
-	hash := tx.Hash()
-	tx.TxID = hex.EncodeToString(hash)
-
-	sigBytes, err := ecdsa.SignASN1(rand.Reader, privateKey, hash)
-	if err != nil {
-		return nil, err
-	}
-
-	return sigBytes, nil
+	LockTime   uint32   `json:"lock_time"` // block height or unix time before which the transaction cannot be included, see IsFinal
 }
 
 func (tx *Transaction) IsValid() bool {
@@ -79,39 +68,75 @@ func (tx *Transaction) IsValid() bool {
 	return true
 }
 
-// Hash hashes the transaction data leaving the txID and scriptSig of each inputs
+// Hash hashes the canonical encoding of the transaction leaving out the scriptSig of each input,
+// since the scriptSigs carry the signatures over this hash
 func (tx *Transaction) Hash() []byte {
-	txData := tx.Sender + tx.Recipent + strconv.Itoa(tx.Amount) + tx.Timestamps + strconv.FormatBool(tx.IsCoinbase)
+	var e encoder
+	e.writeTransaction(tx, false)
 
-	for _, input := range tx.Inputs {
-		txData += input.PrevTxID + strconv.Itoa(input.OutputIndex)
-	}
+	hash := sha256.Sum256(e.buf)
 
-	for _, output := range tx.Outputs {
-		txData += strconv.Itoa(output.Value) + output.ScriptPubKey
-	}
+	return hash[:]
+}
 
-	hash := sha256.Sum256([]byte(txData))
+// FullHash hashes the canonical encoding of the transaction including the scriptSig of each input.
+// The merkle tree of a block is built from it, so that the block hash commits to the scriptSigs too.
+func (tx *Transaction) FullHash() []byte {
+	hash := sha256.Sum256(tx.Serialize())
 
 	return hash[:]
 }
 
-func TransactionsToString(transactions []Transaction) string {
-	txStr := []string{}
-	for _, tx := range transactions {
-		inputsStr := []string{}
-		for _, input := range tx.Inputs {
-			inputsStr = append(inputsStr, input.PrevTxID+", "+strconv.Itoa(input.OutputIndex)+", ")
-		}
+// calculateID returns the hex encoded transaction hash that identifies the transaction
+func (tx *Transaction) calculateID() string {
+	return hex.EncodeToString(tx.Hash())
+}
 
-		outputsStr := []string{}
-		for _, output := range tx.Outputs {
-			outputsStr = append(outputsStr, strconv.Itoa(output.Value)+", "+output.ScriptPubKey)
-		}
+// coinbaseInput returns the single input of the coinbase transaction of the block at height.
+// It spends no output, but committing to the height keeps coinbase transaction ids unique
+// even when two blocks pay the same amount to the same address within the same second.
+func coinbaseInput(height uint64) Input {
+	return Input{OutputIndex: int(height), Sequence: MaxSequence}
+}
 
-		txStr = append(txStr, strconv.FormatBool(tx.IsCoinbase)+", "+strings.Join(inputsStr, ", ")+
-			", "+strings.Join(outputsStr, ", "))
+// SpentInputs returns the inputs of the transaction that spend an output, which excludes the input of a coinbase
+func (tx *Transaction) SpentInputs() []Input {
+	if tx.IsCoinbase {
+		return nil
 	}
+	return tx.Inputs
+}
+
+// OutputUTXO returns output index of the transaction as a utxo created at height
+func (tx *Transaction) OutputUTXO(index int, height uint64) UTXO {
+	output := tx.Outputs[index]
+	return UTXO{
+		TxID:         tx.TxID,
+		OutputIndex:  index,
+		Value:        output.Value,
+		ScriptPubKey: output.ScriptPubKey,
+		Height:       height,
+		IsCoinbase:   tx.IsCoinbase,
+	}
+}
 
-	return strings.Join(txStr, "\n")
+// UTXOs returns the outputs of the transaction as utxos created at height,
+// leaving out unspendable outputs which never enter the utxo set
+func (tx *Transaction) UTXOs(height uint64) []UTXO {
+	var utxos []UTXO
+	for index, output := range tx.Outputs {
+		if !output.IsUnspendable() {
+			utxos = append(utxos, tx.OutputUTXO(index, height))
+		}
+	}
+	return utxos
+}
+
+// OutputSum returns the total value of the outputs of the transaction
+func (tx *Transaction) OutputSum() int {
+	sum := 0
+	for _, output := range tx.Outputs {
+		sum += output.Value
+	}
+	return sum
 }
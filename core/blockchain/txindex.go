@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TxLocation locates a transaction on the main chain by its block and its position in the block
+type TxLocation struct {
+	BlockHash string `json:"block_hash"`
+	Position  int    `json:"position"`
+}
+
+// TxInfo is a transaction looked up by id, along with the block including it.
+// Transactions still in the mempool have no block and no confirmations.
+type TxInfo struct {
+	Transaction   *Transaction `json:"transaction"`
+	BlockHash     string       `json:"block_hash,omitempty"`
+	BlockHeight   uint64       `json:"block_height,omitempty"`
+	Position      int          `json:"position"`
+	Confirmations int          `json:"confirmations"` // number of blocks from the block including the transaction up to the tip
+}
+
+// GetTransaction looks up the transaction with id txID on the main chain, falling back to the mempool
+func (cs *ChainState) GetTransaction(txID string) (*TxInfo, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	loc, err := cs.utxoSet.Store().GetTxLocation(txID)
+	if errors.Is(err, ErrTxNotFound) {
+		if tx, exists := cs.mempool.Tx(txID); exists {
+			return &TxInfo{Transaction: tx}, nil
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := cs.blockchain.GetBlock(loc.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	if loc.Position < 0 || loc.Position >= len(b.TxData) || b.TxData[loc.Position].TxID != txID {
+		return nil, fmt.Errorf("tx index entry of transaction:[%s] does not match block:[%s]", txID, b.Hash)
+	}
+
+	return &TxInfo{
+		Transaction:   &b.TxData[loc.Position],
+		BlockHash:     b.Hash,
+		BlockHeight:   b.Height,
+		Position:      loc.Position,
+		Confirmations: cs.blockchain.GetBlockchainHeight() - int(b.Height) + 1,
+	}, nil
+}
+
+// BuildTxIndex indexes the transactions of the main chain if the tip is not indexed yet,
+// such as for stores written before the index was kept
+func (cs *ChainState) BuildTxIndex() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	store := cs.utxoSet.Store()
+	tip, err := cs.blockchain.Tip()
+	if err != nil || tip == nil || len(tip.TxData) == 0 {
+		return err
+	}
+	_, err = store.GetTxLocation(tip.TxData[0].TxID)
+	if !errors.Is(err, ErrTxNotFound) {
+		return err
+	}
+
+	log.Info("Indexing transactions of the main chain")
+	return cs.blockchain.ForEachBlock(0, func(b *Block) error {
+		if err := store.WriteTxIndex(b); err != nil {
+			return fmt.Errorf("Error indexing transactions of block:[%s]: %v", b.Hash, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetTransaction(t *testing.T) {
+	cs := newTestChainState(t)
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity+1)
+	bc := cs.Blockchain()
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmed := newTestTx([]string{genesis.TxData[0].TxID}, Subsidy(0))
+	b := newTestChainBlock(t, cs, tip, 30, *confirmed)
+	if _, err := cs.ProcessBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	last := extendTestChain(t, cs, b, 1)
+	pending := newTestTx([]string{first.TxData[0].TxID}, Subsidy(1))
+	if err := cs.AcceptTx(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		txID string
+		want TxInfo // without the transaction
+	}{
+		{"confirmed", confirmed.TxID, TxInfo{BlockHash: b.Hash, BlockHeight: b.Height, Position: 1, Confirmations: 2}},
+		{"coinbase", b.TxData[0].TxID, TxInfo{BlockHash: b.Hash, BlockHeight: b.Height, Position: 0, Confirmations: 2}},
+		{"genesis coinbase", genesis.TxData[0].TxID, TxInfo{BlockHash: genesis.Hash, Confirmations: int(last.Height) + 1}},
+		{"mempool", pending.TxID, TxInfo{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := cs.GetTransaction(tt.txID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Transaction.TxID != tt.txID {
+				t.Errorf("transaction = %s, want %s", info.Transaction.TxID, tt.txID)
+			}
+			info.Transaction = nil
+			if *info != tt.want {
+				t.Errorf("GetTransaction() = %+v, want %+v", *info, tt.want)
+			}
+		})
+	}
+
+	if _, err := cs.GetTransaction(newTestTx([]string{"aa"}, 1).TxID); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("GetTransaction(unknown) = %v, want %v", err, ErrTxNotFound)
+	}
+
+	t.Run("disconnect", func(t *testing.T) {
+		for range 2 {
+			if _, err := cs.DisconnectTip(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store := bc.Store()
+		for _, txID := range []string{confirmed.TxID, b.TxData[0].TxID, last.TxData[0].TxID} {
+			if _, err := store.GetTxLocation(txID); !errors.Is(err, ErrTxNotFound) {
+				t.Errorf("transaction:[%s] of a disconnected block still indexed: %v", txID, err)
+			}
+		}
+
+		// the transaction of the disconnected block is back in the mempool, the coinbase is gone
+		if info, err := cs.GetTransaction(confirmed.TxID); err != nil || info.BlockHash != "" || info.Confirmations != 0 {
+			t.Errorf("GetTransaction(disconnected) = %+v, %v, want it from the mempool", info, err)
+		}
+		if _, err := cs.GetTransaction(b.TxData[0].TxID); !errors.Is(err, ErrTxNotFound) {
+			t.Errorf("GetTransaction(disconnected coinbase) = %v, want %v", err, ErrTxNotFound)
+		}
+		if info, err := cs.GetTransaction(genesis.TxData[0].TxID); err != nil || info.Confirmations != int(b.Height) {
+			t.Errorf("GetTransaction(genesis coinbase) = %+v, %v, want %d confirmations", info, err, b.Height)
+		}
+	})
+}
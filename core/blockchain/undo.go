@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BlockUndo is the undo record of a block connected to the main chain. It holds the outputs spent
+// by the transactions of the block, in the order of their inputs, so that disconnecting the block
+// restores them exactly as they were, without looking up the transactions that created them.
+type BlockUndo struct {
+	Spent []UTXO
+}
+
+// spentUTXOs returns the outputs spent by the transactions of b, in the order of their inputs.
+// Outputs created earlier in b are taken from b, the others are resolved with lookup.
+func spentUTXOs(b *Block, lookup func(txID string, index int) (UTXO, bool)) ([]UTXO, error) {
+	created := make(map[string]UTXO)
+	var spent []UTXO
+	for _, tx := range b.TxData {
+		for _, input := range tx.SpentInputs() {
+			key := outpoint(input.PrevTxID, input.OutputIndex)
+			utxo, exists := created[key]
+			if !exists {
+				utxo, exists = lookup(input.PrevTxID, input.OutputIndex)
+			}
+			if !exists {
+				return nil, fmt.Errorf("output %s spent by transaction:[%s] not found", key, tx.TxID)
+			}
+			spent = append(spent, utxo)
+		}
+		for _, utxo := range tx.UTXOs(b.Height) {
+			created[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+		}
+	}
+	return spent, nil
+}
+
+// blockUndo returns the undo record of b, a block of the main chain. Blocks connected before undo
+// records were kept have none, so the outputs they spent are resolved with the transaction index.
+func (cs *ChainState) blockUndo(b *Block) (*BlockUndo, error) {
+	store := cs.utxoSet.Store()
+	undo, err := store.GetBlockUndo(b.Hash)
+	if !errors.Is(err, ErrNoUndo) {
+		return undo, err
+	}
+
+	spent, err := spentUTXOs(b, func(txID string, index int) (UTXO, bool) {
+		loc, err := store.GetTxLocation(txID)
+		if err != nil {
+			return UTXO{}, false
+		}
+		prev, err := store.GetBlock(loc.BlockHash)
+		if err != nil || loc.Position >= len(prev.TxData) {
+			return UTXO{}, false
+		}
+		prevTx := prev.TxData[loc.Position]
+		if index < 0 || index >= len(prevTx.Outputs) {
+			return UTXO{}, false
+		}
+		return prevTx.OutputUTXO(index, prev.Height), true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error rebuilding undo record of block:[%s]: %v", b.Hash, err)
+	}
+	return &BlockUndo{Spent: spent}, nil
+}
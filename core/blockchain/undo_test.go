@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestUndoBlock connects a block on top of a chain whose genesis coinbase is mature. The block spends
+// the genesis coinbase and, within the block, an output of the spending transaction.
+// It returns the block along with the utxo set before it was connected.
+func newTestUndoBlock(t *testing.T, cs *ChainState) (*Block, UTXOMap) {
+	t.Helper()
+	tip := extendTestChain(t, cs, nil, CoinbaseMaturity)
+	genesis, err := cs.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := snapshotUTXOs(cs)
+
+	spend := newTestTx([]string{genesis.TxData[0].TxID}, 20, Subsidy(0)-21)
+	child := newTestTx(nil, 19)
+	child.Inputs = []Input{{PrevTxID: spend.TxID, OutputIndex: 1, Sequence: MaxSequence}}
+	child.TxID = child.calculateID()
+
+	b := newTestChainBlock(t, cs, tip, 30, *spend, *child)
+	if _, err := cs.ProcessBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	return b, before
+}
+
+func TestBlockUndoRecord(t *testing.T) {
+	cs := newTestChainState(t)
+	b, _ := newTestUndoBlock(t, cs)
+	genesis, err := cs.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	undo, err := cs.Blockchain().Store().GetBlockUndo(b.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UTXO{genesis.TxData[0].OutputUTXO(0, 0), b.TxData[1].OutputUTXO(1, b.Height)}
+	if !want[0].IsCoinbase || want[1].IsCoinbase {
+		t.Fatal("want the coinbase flag set only on the genesis output")
+	}
+	if !slices.Equal(undo.Spent, want) {
+		t.Errorf("undo record = %+v, want %+v", undo.Spent, want)
+	}
+}
+
+func TestDisconnectTip(t *testing.T) {
+	tests := []struct {
+		name     string
+		dropUndo bool // the block was connected before undo records were kept
+	}{
+		{"undo record", false},
+		{"rebuilt from tx index", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := newTestChainState(t)
+			b, before := newTestUndoBlock(t, cs)
+			store := cs.Blockchain().Store()
+			if tt.dropUndo {
+				err := store.Db().Update(func(tx *bolt.Tx) error {
+					return tx.Bucket([]byte(undoBucket)).Delete([]byte(b.Hash))
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			disconnected, err := cs.DisconnectTip()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if disconnected.Hash != b.Hash || cs.Blockchain().TipHash() != b.PrevHash {
+				t.Fatalf("disconnected %s leaving tip %s, want %s leaving its parent", disconnected.Hash, cs.Blockchain().TipHash(), b.Hash)
+			}
+			if got := snapshotUTXOs(cs); !equalUTXOs(got, before) {
+				t.Errorf("utxo set after disconnect = %v, want %v", got, before)
+			}
+
+			reloaded, err := NewUTXOSet(store, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalUTXOs(reloaded.UTXOs, before) {
+				t.Errorf("utxo set loaded from db = %v, want %v", reloaded.UTXOs, before)
+			}
+			if tip, err := store.TipHash(); err != nil || tip != b.PrevHash {
+				t.Errorf("stored tip = %s, %v, want %s", tip, err, b.PrevHash)
+			}
+			if _, err := store.GetBlockUndo(b.Hash); !errors.Is(err, ErrNoUndo) {
+				t.Errorf("undo record of disconnected block: %v, want %v", err, ErrNoUndo)
+			}
+			for _, tx := range b.TxData {
+				if _, err := store.GetTxLocation(tx.TxID); !errors.Is(err, ErrTxNotFound) {
+					t.Errorf("transaction:[%s] of disconnected block still indexed: %v", tx.TxID, err)
+				}
+			}
+
+			// the block stays stored as part of the block tree
+			if _, err := cs.ProcessBlock(b); !errors.Is(err, ErrBlockKnown) {
+				t.Fatalf("ProcessBlock(disconnected block) = %v, want %v", err, ErrBlockKnown)
+			}
+		})
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/sha256"
-	"errors"
 	"fmt"
 
 	"github.com/mr-tron/base58/base58"
-	"golang.org/x/crypto/ripemd160"
 )
 
 // PublicKeyToPubKeyHash convert the public key pubkey to public key hash by first hashing the public key with
@@ -18,85 +16,98 @@ func PublicKeyToPubKeyHash(pubKey *ecdsa.PublicKey) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Invalid public key: %v", err)
 	}
-	publicKeyBytes := pubkeyECDH.Bytes()
-
-	sha256Hash := sha256.Sum256(publicKeyBytes)
-	ripemd160Hasher := ripemd160.New()
-	ripemd160Hasher.Write(sha256Hash[:])
-	ripemd160Hash := ripemd160Hasher.Sum(nil)
-
-	return ripemd160Hash, nil
+	return hash160(pubkeyECDH.Bytes()), nil
 }
 
-// PubKeyHashToAddress convert the public key bytes to address in base58-encoded string
-func PubKeyHashToAddress(pubKeyHash []byte) string {
-	firstHash := sha256.Sum256(pubKeyHash)
+// scriptHashAddrID prefixes the payload of pay-to-script-hash addresses. Pay-to-pubkey-hash
+// addresses carry the bare public key hash, so the two are told apart by the payload length.
+const scriptHashAddrID = 0x05
+
+// encodeAddress encodes payload followed by its checksum in base58
+func encodeAddress(payload []byte) string {
+	firstHash := sha256.Sum256(payload)
 	secondHash := sha256.Sum256(firstHash[:])
 
 	checksum := secondHash[:4]
 
-	addressBytes := append(pubKeyHash, checksum...)
+	addressBytes := append(bytes.Clone(payload), checksum...)
 	return base58.Encode(addressBytes)
 }
 
-// AddressToPubKeyHash convert the base58-encoded string to public key hash
-func AddressToPubKeyHash(address string) ([]byte, error) {
+// decodeAddress decodes a base58-encoded address and returns its payload after checking the checksum
+func decodeAddress(address string) ([]byte, error) {
 	addressBytes, err := base58.Decode(address)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to decode address", err)
+		return nil, fmt.Errorf("Failed to decode address: %v", err)
+	}
+	if len(addressBytes) < 4 {
+		return nil, fmt.Errorf("Address too short: %s", address)
 	}
 
-	pubKeyHash := addressBytes[:len(addressBytes)-4]
-	firstHash := sha256.Sum256(pubKeyHash)
+	payload := addressBytes[:len(addressBytes)-4]
+	firstHash := sha256.Sum256(payload)
 	secondHash := sha256.Sum256(firstHash[:])
 
 	checksumbytes := addressBytes[len(addressBytes)-4:]
 
 	if !bytes.Equal(checksumbytes, secondHash[:4]) {
-		return nil, fmt.Errorf("Checksum mismatched ", checksumbytes, secondHash[:4])
+		return nil, fmt.Errorf("Checksum mismatched: %x != %x", checksumbytes, secondHash[:4])
 	}
-	return pubKeyHash, nil
+	return payload, nil
 }
 
-func CreateScriptSig(signature, pubKey []byte) []byte {
-	var scriptSig bytes.Buffer
-
-	scriptSig.WriteByte(byte(len(signature)))
-	scriptSig.Write(signature)
-
-	scriptSig.WriteByte(byte(len(pubKey)))
-	scriptSig.Write(pubKey)
-
-	return scriptSig.Bytes()
+// PubKeyHashToAddress convert the public key bytes to address in base58-encoded string
+func PubKeyHashToAddress(pubKeyHash []byte) string {
+	return encodeAddress(pubKeyHash)
 }
 
-// SplitScriptSig splits the scriptSig byte slice into its consitituent signature bytes and public key bytes
-func SplitScriptSig(scriptSig []byte) ([]byte, []byte, error) { // Ensure the scriptSig has enough data to process
-	if len(scriptSig) < 2 {
-		return nil, nil, errors.New("scriptSig too short to contain both signature and public key")
+// AddressToPubKeyHash convert the base58-encoded string to public key hash
+func AddressToPubKeyHash(address string) ([]byte, error) {
+	payload, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 20 {
+		return nil, fmt.Errorf("Not a pay-to-pubkey-hash address: %s", address)
 	}
+	return payload, nil
+}
 
-	sigLength := int(scriptSig[0])
-	sigBytes := scriptSig[1 : 1+sigLength]
+// ScriptHashToAddress converts the hash of a redeem script to a pay-to-script-hash address
+func ScriptHashToAddress(scriptHash []byte) string {
+	return encodeAddress(append([]byte{scriptHashAddrID}, scriptHash...))
+}
 
-	pubKeyLength := int(scriptSig[1+sigLength])
-	pubKeyBytes := scriptSig[1+sigLength+1 : 1+sigLength+1+pubKeyLength]
+// AddressToScriptHash returns the redeem script hash of a pay-to-script-hash address
+func AddressToScriptHash(address string) ([]byte, error) {
+	payload, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 21 || payload[0] != scriptHashAddrID {
+		return nil, fmt.Errorf("Not a pay-to-script-hash address: %s", address)
+	}
+	return payload[1:], nil
+}
 
-	return sigBytes, pubKeyBytes, nil
+// CreateScriptSig returns the scriptSig spending a pay-to-pubkey-hash output: <signature> <pubKey>
+func CreateScriptSig(signature, pubKey []byte) []byte {
+	var b ScriptBuilder
+	return b.AddData(signature).AddData(pubKey).Script()
 }
 
 // RetryN retries the given function up to n times if it returns an error.
 // Logs retryMsg before each retry (except the last).
-// Returns nil whether it succeeds or not.
+// Returns the error of the last attempt, prefixed with retryMsg, if every attempt failed.
 func RetryN(fn func() error, n int, retryMsg string) error {
+	var err error
 	for i := 1; i <= n; i++ {
-		err := fn()
-		if err == nil {
-			break
+		if err = fn(); err == nil {
+			return nil
 		}
 		if i < n {
-			fmt.Printf("%s (attempt %d/%d)", retryMsg, i, n)
+			log.Warnf("%s (attempt %d/%d): %v\n", retryMsg, i, n, err)
 		}
 	}
-	return nil
+	return fmt.Errorf("%s: %w", retryMsg, err)
 }
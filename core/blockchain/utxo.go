@@ -1,11 +1,10 @@
 package blockchain
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -14,6 +13,7 @@ type Input struct {
 	PrevTxID    string `json:"prev_tx_id"`
 	OutputIndex int    `json:"output_index"`
 	ScriptSig   string `json:"script_sig"` // Note: ScriptSig here is a simplified representation and does not reflect the actual Bitcoin implementation.
+	Sequence    uint32 `json:"sequence"`   // relative lock time of the input, MaxSequence if the input is final
 }
 
 // Output represents output in a transaction
@@ -22,20 +22,61 @@ type Output struct {
 	ScriptPubKey string
 }
 
+// IsUnspendable reports whether the scriptPubKey of the output starts with OP_RETURN.
+// Such outputs can never be spent and are kept out of the utxo set.
+func (out Output) IsUnspendable() bool {
+	return strings.HasPrefix(out.ScriptPubKey, hex.EncodeToString([]byte{byte(OP_RETURN)}))
+}
+
+// Data returns the payload of a data carrier output
+func (out Output) Data() ([]byte, bool) {
+	script, err := hex.DecodeString(out.ScriptPubKey)
+	if err != nil {
+		return nil, false
+	}
+	return extractNullData(script)
+}
+
 // UTXO is used to track unspent outputs
 type UTXO struct {
 	TxID         string
 	OutputIndex  int
 	Value        int
 	ScriptPubKey string
+	Height       uint64 // height of the block that created the output
+	IsCoinbase   bool   // whether the output was created by a coinbase transaction
+}
+
+// IsMature reports whether the utxo can be spent by a transaction included at height.
+// Coinbase outputs can only be spent once they are CoinbaseMaturity blocks deep.
+func (u *UTXO) IsMature(height uint64) bool {
+	return !u.IsCoinbase || height >= u.Height+CoinbaseMaturity
+}
+
+// Balance is the value of the utxos owned by an address, split by whether they can be spent yet
+type Balance struct {
+	Spendable int `json:"spendable"`
+	Immature  int `json:"immature"` // coinbase outputs not yet CoinbaseMaturity blocks deep
 }
 
 type UTXOMap map[string]map[int]UTXO
 
+// TxOutSetInfo summarises the utxo set, allowing the coin supply to be audited against the subsidy schedule
+type TxOutSetInfo struct {
+	Height       int    `json:"height"`
+	BestBlock    string `json:"best_block"`
+	Transactions int    `json:"transactions"` // number of transactions with unspent outputs
+	TxOuts       int    `json:"txouts"`       // number of unspent outputs
+	TotalAmount  int    `json:"total_amount"` // sum of the values of all unspent outputs
+	TotalIssued  int    `json:"total_issued"` // coins the subsidy schedule allows up to the tip
+	MaxSupply    int    `json:"max_supply"`
+}
+
 type UTXOSet struct {
-	UTXOs UTXOMap // map of transaction id mapped to output indexes mapped to UTXO
-	store *Store
-	mu    sync.Mutex
+	UTXOs     UTXOMap // map of transaction id mapped to output indexes mapped to UTXO
+	store     *Store
+	addrIndex bool // whether the address index of the store is kept up to date
+	mu        sync.Mutex
 }
 
 func NewUTXOSet(store *Store, utxoBucket string) (*UTXOSet, error) {
@@ -70,19 +111,14 @@ func (us *UTXOSet) Load() error {
 	return err
 }
 
-func (us *UTXOSet) addUTXO(txID string, outputIndex int, value int, scriptPubKey string) {
+func (us *UTXOSet) addUTXO(utxo UTXO) {
 	us.mu.Lock()
 	defer us.mu.Unlock()
 
-	if _, exists := us.UTXOs[txID]; !exists {
-		us.UTXOs[txID] = make(map[int]UTXO)
-	}
-	us.UTXOs[txID][outputIndex] = UTXO{
-		TxID:         txID,
-		OutputIndex:  outputIndex,
-		Value:        value,
-		ScriptPubKey: scriptPubKey,
+	if _, exists := us.UTXOs[utxo.TxID]; !exists {
+		us.UTXOs[utxo.TxID] = make(map[int]UTXO)
 	}
+	us.UTXOs[utxo.TxID][utxo.OutputIndex] = utxo
 }
 
 func (us *UTXOSet) removeUTXO(txID string, outputIndex int) {
@@ -97,77 +133,106 @@ func (us *UTXOSet) removeUTXO(txID string, outputIndex int) {
 	}
 }
 
-// Update applies a batch of transactions to the UTXO set, writing updates to the database with retries.
-// It removes spent UTXOs and adds new ones based on transaction outputs
-func (us *UTXOSet) Update(txs []Transaction) error {
-	for _, transaction := range txs {
-		err := RetryN(func() error {
-			err := us.Store().WriteUTXOs(transaction)
-			return err
-		}, 3, fmt.Sprintf("Failed to update utxoSet in db for transaction:[%s]", transaction.TxID))
-
-		if err != nil {
-			return err
-		}
-	}
-
+// apply applies a batch of transactions of the block at height to the in-memory utxo set, once their
+// changes were written to the db. It removes spent UTXOs and adds new ones based on transaction outputs.
+func (us *UTXOSet) apply(txs []Transaction, height uint64) {
 	for _, tx := range txs {
-		for _, input := range tx.Inputs {
+		for _, input := range tx.SpentInputs() {
 			us.removeUTXO(input.PrevTxID, input.OutputIndex)
 		}
-		for index, output := range tx.Outputs {
-			us.addUTXO(tx.TxID, index, output.Value, output.ScriptPubKey)
+		for _, utxo := range tx.UTXOs(height) {
+			us.addUTXO(utxo)
 		}
 	}
+}
+
+// undo reverts apply for the transactions of block b with its undo record, once the changes were
+// written to the db. Transactions are walked in reverse order, removing the outputs each created
+// and restoring the outputs it spent.
+func (us *UTXOSet) undo(b *Block, undo *BlockUndo) error {
+	spentByTx, err := splitSpent(b, undo.Spent)
+	if err != nil {
+		return err
+	}
 
+	for i := len(b.TxData) - 1; i >= 0; i-- {
+		for _, utxo := range b.TxData[i].UTXOs(0) {
+			us.removeUTXO(utxo.TxID, utxo.OutputIndex)
+		}
+		for _, utxo := range spentByTx[i] {
+			us.addUTXO(utxo)
+		}
+	}
 	return nil
 }
 
 func (us *UTXOSet) GetUTXO(txID string, outIndex int) (UTXO, error) {
-	var utxo UTXO
-	for transactionID, transactions := range us.UTXOs {
-		if transactionID == txID {
-			for outputIndex, utxo := range transactions {
-				if outputIndex == outIndex {
-					return utxo, nil
-				}
-			}
-		}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if utxo, exists := us.UTXOs[txID][outIndex]; exists {
+		return utxo, nil
 	}
-	return utxo, errors.New("UTXO not found with specified transaction id and output index.")
+	return UTXO{}, errors.New("UTXO not found with specified transaction id and output index.")
+}
+
+// lookupUTXO returns the utxo created by output index of transaction txID if it is unspent
+func (us *UTXOSet) lookupUTXO(txID string, index int) (UTXO, bool) {
+	utxo, err := us.GetUTXO(txID, index)
+	return utxo, err == nil
 }
 
 func (us *UTXOSet) GetTotalBalByAddress(address string) int {
 	var totalBal int
-	for _, transactions := range us.UTXOs {
-		for _, utxo := range transactions {
-			pubKeyHash, err := hex.DecodeString(utxo.ScriptPubKey)
-			if err != nil {
-				log.Error("Error getting balance: Cannot decode hex encoded scriptPubKey", err)
-				return 0
-			}
+	for _, utxo := range us.GetAvailableUTXOS(address) {
+		totalBal += utxo.Value
+	}
+	return totalBal
+}
 
-			utxoAddr := PubKeyHashToAddress(pubKeyHash)
-			if utxoAddr == address {
-				totalBal += utxo.Value
-			}
+// GetBalanceByAddress returns the balance of address for a transaction included at height,
+// reporting coinbase outputs that cannot be spent yet separately
+func (us *UTXOSet) GetBalanceByAddress(address string, height uint64) Balance {
+	var bal Balance
+	for _, utxo := range us.GetAvailableUTXOS(address) {
+		if utxo.IsMature(height) {
+			bal.Spendable += utxo.Value
+		} else {
+			bal.Immature += utxo.Value
 		}
 	}
-	return totalBal
+	return bal
 }
 
-// GetAvailableIns returns slice of Input available to a address
+// GetSpendableUTXOS returns the utxos of address that a transaction included at height can spend
+func (us *UTXOSet) GetSpendableUTXOS(address string, height uint64) []UTXO {
+	var utxos []UTXO
+	for _, utxo := range us.GetAvailableUTXOS(address) {
+		if utxo.IsMature(height) {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos
+}
+
+// GetAvailableUTXOS returns the utxos of address. They are looked up in the address index if it is
+// enabled, otherwise the whole utxo set is scanned.
 func (us *UTXOSet) GetAvailableUTXOS(address string) []UTXO {
+	if us.addrIndex {
+		utxos, err := us.Store().AddressUTXOs(address)
+		if err == nil {
+			return utxos
+		}
+		log.Warnf("Error looking up utxos of address:[%s] in address index: %v\n", address, err)
+	}
+
 	var utxos []UTXO
 	for _, transactions := range us.UTXOs {
 		for _, output := range transactions {
-			pubKeyHash, err := hex.DecodeString(output.ScriptPubKey)
+			utxoAddr, err := ScriptPubKeyToAddress(output.ScriptPubKey)
 			if err != nil {
-				log.Error("Error decoding scriptPubKey", err)
-				return utxos
+				continue
 			}
-
-			utxoAddr := PubKeyHashToAddress(pubKeyHash)
 			if utxoAddr == address {
 				utxos = append(utxos, output)
 			}
@@ -176,7 +241,25 @@ func (us *UTXOSet) GetAvailableUTXOS(address string) []UTXO {
 	return utxos
 }
 
-// ResolveInputs selects enough inputs to meet the specified amount to be sent.
+// Info returns statistics of the utxo set. The caller fills in the chain related fields.
+func (us *UTXOSet) Info() TxOutSetInfo {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	info := TxOutSetInfo{
+		Transactions: len(us.UTXOs),
+		MaxSupply:    MaxSupply,
+	}
+	for _, outputs := range us.UTXOs {
+		for _, utxo := range outputs {
+			info.TxOuts++
+			info.TotalAmount += utxo.Value
+		}
+	}
+	return info
+}
+
+// ResolveInputs selects enough inputs to meet the specified amount to be sent, which should include the fee.
 // Returns an error if the sum of inputs is insufficient.
 func ResolveInputs(totalUTXOs []UTXO, amtToBeSent int) ([]Input, error) {
 	var inputs []Input
@@ -191,6 +274,7 @@ func ResolveInputs(totalUTXOs []UTXO, amtToBeSent int) ([]Input, error) {
 			input := Input{
 				PrevTxID:    utxo.TxID,
 				OutputIndex: utxo.OutputIndex,
+				Sequence:    MaxSequence,
 			}
 			inputs = append(inputs, input)
 			inputAmtSum += utxo.Value
@@ -205,83 +289,31 @@ func ResolveInputs(totalUTXOs []UTXO, amtToBeSent int) ([]Input, error) {
 	return inputs, nil
 }
 
-// DeriveOutputs generates transaction outputs based on inputs, amount, recipient, and sender addresses.
-// It creates up to two outputs: one for the recipient and, if needed, another for the sender's remaining balance.
-func (us *UTXOSet) DeriveOutputs(inputs []Input, amount int, recipAddr, senderAddr string) []Output {
-	totalInputAmount := 0
-	var outputs []Output
-	for _, inp := range inputs {
-		utxo, err := us.GetUTXO(inp.PrevTxID, inp.OutputIndex)
-
-		if err != nil {
-			log.Error("Invalid input, found no corressponding output", err)
-			return outputs
-		}
-
-		totalInputAmount += utxo.Value
-	}
-
-	senderPubKeyHash, err := AddressToPubKeyHash(senderAddr)
-	if err != nil {
-		log.Error("Invalid sender address")
-		return outputs
-	}
-	recipAddrPubKeyHash, err := AddressToPubKeyHash(recipAddr)
-	if err != nil {
-		log.Error("Invalid recipent address")
-		return outputs
-	}
+// Approximate encoded sizes of the parts of a signed pay-to-pubkey-hash transaction, used to estimate fees
+const (
+	estimatedTxBaseSize = 150
+	estimatedInputSize  = 360
+	estimatedOutputSize = 60
+)
 
-	if totalInputAmount > amount {
-		// we can have two outputs at max in our implementation since in a single transaction one address can send to only one address
-		// thus resulting two outputs at max -> one for the receipent and the other output(if applicable) for the remaining amount for the sender itself
-		output1 := Output{
-			Value:        totalInputAmount - amount,
-			ScriptPubKey: hex.EncodeToString(senderPubKeyHash),
-		}
-		output2 := Output{
-			Value:        amount,
-			ScriptPubKey: hex.EncodeToString(recipAddrPubKeyHash),
-		}
-		outputs = append(outputs, output1, output2)
-	} else if totalInputAmount == amount {
-		output := Output{
-			Value:        amount,
-			ScriptPubKey: hex.EncodeToString(recipAddrPubKeyHash),
-		}
-		outputs = append(outputs, output)
-	}
-	return outputs
+// EstimateFee returns the fee a signed transaction spending numInputs outputs into numOutputs outputs
+// has to pay to reach feeRate per byte
+func EstimateFee(feeRate, numInputs, numOutputs int) int {
+	size := estimatedTxBaseSize + numInputs*estimatedInputSize + numOutputs*estimatedOutputSize
+	return feeRate * size
 }
 
-func UnlockUTXO(input Input, utxo UTXO, txHash []byte) error {
-	pubKeyHashHex := utxo.ScriptPubKey
-
-	scriptSigBytes, err := hex.DecodeString(input.ScriptSig)
+// UnlockUTXO checks that input index of tx can spend utxo by executing the scriptSig of the input
+// followed by the scriptPubKey of the utxo
+func UnlockUTXO(tx *Transaction, index int, utxo UTXO) error {
+	scriptSig, err := hex.DecodeString(tx.Inputs[index].ScriptSig)
 	if err != nil {
-		return fmt.Errorf("Error decoding scriptsig hex of input", err)
+		return fmt.Errorf("Error decoding scriptsig hex of input: %v", err)
 	}
-
-	sigBytes, pubkeyBytes, err := SplitScriptSig(scriptSigBytes)
-	if err != nil {
-		return fmt.Errorf("Invalid scriptsig of input", err)
-	}
-
-	x, y := elliptic.Unmarshal(elliptic.P256(), pubkeyBytes)
-	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
-
-	pubKeyHashBytes, err := PublicKeyToPubKeyHash(publicKey)
+	scriptPubKey, err := hex.DecodeString(utxo.ScriptPubKey)
 	if err != nil {
-		return err
-	}
-	if pubKeyHashHex != hex.EncodeToString(pubKeyHashBytes) {
-		return errors.New("Cannot spend the corressponding output: Owner mismatched")
+		return fmt.Errorf("Error decoding scriptPubKey hex of output: %v", err)
 	}
 
-	verified := ecdsa.VerifyASN1(publicKey, txHash, sigBytes)
-	if !verified {
-		return errors.New("Invalid signature")
-	}
-
-	return nil
+	return VerifyScript(scriptSig, scriptPubKey, txInputChecker{tx: tx, index: index, utxo: utxo})
 }
@@ -0,0 +1,44 @@
+package blockchain
+
+import "testing"
+
+func TestGetBalanceByAddressMaturity(t *testing.T) {
+	wallet := newTestWallet(t)
+	script, err := AddressToScriptPubKey(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := &UTXOSet{UTXOs: make(UTXOMap)}
+	for _, utxo := range []UTXO{
+		{TxID: "aa", Value: 50, ScriptPubKey: script, Height: 0, IsCoinbase: true},
+		{TxID: "bb", Value: 25, ScriptPubKey: script, Height: 5, IsCoinbase: true},
+		{TxID: "cc", Value: 7, ScriptPubKey: script, Height: 9},
+		{TxID: "dd", Value: 1000, ScriptPubKey: "51", Height: 0, IsCoinbase: true}, // pays to no address
+	} {
+		us.addUTXO(utxo)
+	}
+
+	tests := []struct {
+		height uint64
+		want   Balance
+	}{
+		{CoinbaseMaturity - 1, Balance{Spendable: 7, Immature: 75}},
+		{CoinbaseMaturity, Balance{Spendable: 57, Immature: 25}},
+		{5 + CoinbaseMaturity - 1, Balance{Spendable: 57, Immature: 25}},
+		{5 + CoinbaseMaturity, Balance{Spendable: 82}},
+	}
+
+	for _, tt := range tests {
+		if got := us.GetBalanceByAddress(wallet.Address, tt.height); got != tt.want {
+			t.Errorf("GetBalanceByAddress(height %d) = %+v, want %+v", tt.height, got, tt.want)
+		}
+		spendable := 0
+		for _, utxo := range us.GetSpendableUTXOS(wallet.Address, tt.height) {
+			spendable += utxo.Value
+		}
+		if spendable != tt.want.Spendable {
+			t.Errorf("GetSpendableUTXOS(height %d) sums to %d, want %d", tt.height, spendable, tt.want.Spendable)
+		}
+	}
+}
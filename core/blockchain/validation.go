@@ -0,0 +1,287 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Consensus errors returned when a block or one of its transactions is rejected.
+// Callers can match them with errors.Is.
+var (
+	ErrInvalidBlockHeight = errors.New("invalid block height")
+	ErrBlockKnown         = errors.New("block already known")
+	ErrOrphanBlock        = errors.New("previous block not found")
+	ErrInvalidParent      = errors.New("previous block is invalid")
+	ErrInvalidBlockHash   = errors.New("invalid block hash")
+	ErrInvalidDifficulty  = errors.New("block bits do not match the required difficulty")
+	ErrInvalidTimestamp   = errors.New("invalid block timestamp")
+	ErrInvalidMerkleRoot  = errors.New("merkle root does not match block transactions")
+	ErrMutatedMerkleTree  = errors.New("merkle tree pairs a node with an identical node")
+	ErrDuplicateTx        = errors.New("block contains a transaction more than once")
+	ErrNoTransactions     = errors.New("block contains no transactions")
+	ErrBlockTooLarge      = errors.New("block exceeds the maximum block size")
+	ErrMissingCoinbase    = errors.New("first transaction is not a coinbase")
+	ErrMisplacedCoinbase  = errors.New("coinbase transaction found after the first position")
+	ErrCoinbaseHeight     = errors.New("coinbase transaction must have a single input committing to the block height")
+	ErrCoinbaseValue      = errors.New("coinbase pays more than the block subsidy plus fees")
+	ErrInvalidTxID        = errors.New("transaction id does not match transaction hash")
+	ErrNoInputs           = errors.New("transaction has no inputs")
+	ErrNoOutputs          = errors.New("transaction has no outputs")
+	ErrInvalidOutputValue = errors.New("output value must be positive, zero only for a data carrier output")
+	ErrValueOutOfRange    = errors.New("value exceeds the maximum supply")
+	ErrInvalidDataOutput  = errors.New("invalid data carrier output")
+	ErrMissingUTXO        = errors.New("input references a missing or spent output")
+	ErrImmatureCoinbase   = errors.New("input spends a coinbase output that has not matured")
+	ErrDoubleSpend        = errors.New("output spent more than once")
+	ErrInvalidScriptSig   = errors.New("input scriptSig failed verification")
+	ErrInsufficientInputs = errors.New("input value does not cover output value")
+	ErrNonFinalTx         = errors.New("transaction lock time has not been reached")
+	ErrSequenceLock       = errors.New("input relative lock time has not been reached")
+)
+
+// TxValidationError reports the transaction of a block that failed validation.
+type TxValidationError struct {
+	TxID string
+	Err  error
+}
+
+func (e *TxValidationError) Error() string {
+	return fmt.Sprintf("transaction [%s]: %v", e.TxID, e.Err)
+}
+
+func (e *TxValidationError) Unwrap() error {
+	return e.Err
+}
+
+// inMoneyRange reports whether v is a valid amount, which no value or sum of values may exceed.
+// Checking every running total against it keeps the sums of values from overflowing.
+func inMoneyRange(v int) bool {
+	return v >= 0 && v <= MaxSupply
+}
+
+// isBlockRuleError reports whether err is the rejection of the transactions of a block by validateBlockTxs,
+// rather than a failure to read or write the block, which says nothing about its validity
+func isBlockRuleError(err error) bool {
+	var txErr *TxValidationError
+	return errors.As(err, &txErr) || errors.Is(err, ErrNoTransactions)
+}
+
+// outpoint returns the key identifying output outIndex of transaction txID.
+// It matches the key format of the utxo bucket.
+func outpoint(txID string, outIndex int) string {
+	return txID + "_" + strconv.Itoa(outIndex)
+}
+
+// utxoView layers the effects of not yet connected transactions over a UTXOSet,
+// so that transactions of a block can be checked in order against each other.
+type utxoView struct {
+	us         *UTXOSet
+	prev       *blockNode // block the transactions are included on top of, nil for the genesis block
+	height     uint64     // height of the block the transactions are included in
+	medianTime int64      // median time past of prev, which time based lock times are checked against
+	spent      map[string]bool
+	created    map[string]UTXO
+}
+
+// newUTXOView creates a view for checking the transactions of a block on top of prev
+func newUTXOView(us *UTXOSet, prev *blockNode) *utxoView {
+	v := &utxoView{
+		us:      us,
+		prev:    prev,
+		spent:   make(map[string]bool),
+		created: make(map[string]UTXO),
+	}
+	if prev != nil {
+		v.height = prev.height + 1
+		v.medianTime = prev.medianTimePast()
+	}
+	return v
+}
+
+func (v *utxoView) get(txID string, outIndex int) (UTXO, error) {
+	key := outpoint(txID, outIndex)
+	if v.spent[key] {
+		return UTXO{}, ErrDoubleSpend
+	}
+	if utxo, exists := v.created[key]; exists {
+		return utxo, nil
+	}
+	utxo, err := v.us.GetUTXO(txID, outIndex)
+	if err != nil {
+		return UTXO{}, ErrMissingUTXO
+	}
+	return utxo, nil
+}
+
+// connect marks the inputs of tx as spent and its outputs as available in the view
+func (v *utxoView) connect(tx *Transaction) {
+	for _, input := range tx.Inputs {
+		v.spent[outpoint(input.PrevTxID, input.OutputIndex)] = true
+	}
+	for _, utxo := range tx.UTXOs(v.height) {
+		v.created[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+}
+
+// checkTx validates a non-coinbase transaction against the view and returns its fee.
+// The transaction must be final, every input must reference an available output whose relative
+// lock time has passed and carry a valid scriptSig, and the inputs must cover the outputs.
+func (v *utxoView) checkTx(tx *Transaction) (int, error) {
+	if err := checkTxSanity(tx); err != nil {
+		return 0, err
+	}
+	if len(tx.Inputs) == 0 {
+		return 0, ErrNoInputs
+	}
+	if !tx.IsFinal(v.height, v.medianTime) {
+		return 0, ErrNonFinalTx
+	}
+
+	seen := make(map[string]bool)
+	inputSum := 0
+	for index, input := range tx.Inputs {
+		key := outpoint(input.PrevTxID, input.OutputIndex)
+		if seen[key] {
+			return 0, ErrDoubleSpend
+		}
+		seen[key] = true
+
+		utxo, err := v.get(input.PrevTxID, input.OutputIndex)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", err, key)
+		}
+		if !utxo.IsMature(v.height) {
+			return 0, fmt.Errorf("%w: %s", ErrImmatureCoinbase, key)
+		}
+		if tx.hasRelativeLockTime(input) && sequenceLocked(input.Sequence, utxo, v.prev) {
+			return 0, fmt.Errorf("%w: %s", ErrSequenceLock, key)
+		}
+		if !inMoneyRange(utxo.Value) {
+			return 0, fmt.Errorf("%w: input %s", ErrValueOutOfRange, key)
+		}
+		inputSum += utxo.Value
+		if !inMoneyRange(inputSum) {
+			return 0, fmt.Errorf("%w: input total", ErrValueOutOfRange)
+		}
+		if err := UnlockUTXO(tx, index, utxo); err != nil {
+			return 0, fmt.Errorf("%w: %s: %v", ErrInvalidScriptSig, key, err)
+		}
+	}
+
+	// checkTxSanity has bounded the output total, so both sums are in range
+	outputSum := tx.OutputSum()
+	if inputSum < outputSum {
+		return 0, ErrInsufficientInputs
+	}
+	return inputSum - outputSum, nil
+}
+
+// checkTransaction validates a non-coinbase transaction to be included in the block on top of prev
+// against the utxo set and returns the fee it pays
+func (us *UTXOSet) checkTransaction(tx *Transaction, prev *blockNode) (int, error) {
+	if tx.IsCoinbase {
+		return 0, ErrMisplacedCoinbase
+	}
+	return newUTXOView(us, prev).checkTx(tx)
+}
+
+// checkTxSanity performs the context-free checks shared by every transaction.
+// Output values and their total must not exceed MaxSupply.
+// A transaction may carry at most one data carrier output, which must not hold any value.
+func checkTxSanity(tx *Transaction) error {
+	if tx.calculateID() != tx.TxID {
+		return ErrInvalidTxID
+	}
+	if len(tx.Outputs) == 0 {
+		return ErrNoOutputs
+	}
+	dataOutputs := 0
+	outputSum := 0
+	for _, output := range tx.Outputs {
+		if output.Value < 0 || output.Value == 0 && !output.IsUnspendable() {
+			return ErrInvalidOutputValue
+		}
+		if !inMoneyRange(output.Value) {
+			return fmt.Errorf("%w: output", ErrValueOutOfRange)
+		}
+		outputSum += output.Value
+		if !inMoneyRange(outputSum) {
+			return fmt.Errorf("%w: output total", ErrValueOutOfRange)
+		}
+		if output.IsUnspendable() {
+			if _, ok := output.Data(); !ok {
+				return fmt.Errorf("%w: payload must be a single push of at most %d bytes", ErrInvalidDataOutput, MaxDataCarrierSize)
+			}
+			if output.Value != 0 {
+				return fmt.Errorf("%w: output carries value", ErrInvalidDataOutput)
+			}
+			dataOutputs++
+		}
+	}
+	if dataOutputs > 1 {
+		return fmt.Errorf("%w: more than one data carrier output", ErrInvalidDataOutput)
+	}
+	return nil
+}
+
+// checkCoinbase validates the coinbase transaction of the block at height,
+// which may claim the block subsidy and the fees of the other transactions
+func checkCoinbase(tx *Transaction, height uint64, fees int) error {
+	if err := checkTxSanity(tx); err != nil {
+		return err
+	}
+	if len(tx.Inputs) != 1 || tx.Inputs[0] != coinbaseInput(height) {
+		return ErrCoinbaseHeight
+	}
+	if tx.LockTime != 0 {
+		return ErrNonFinalTx
+	}
+	if tx.OutputSum() > Subsidy(height)+fees {
+		return ErrCoinbaseValue
+	}
+	return nil
+}
+
+// validateBlockTxs checks the transactions of block b, whose parent is prev, against the UTXO set.
+// The first transaction must be the only coinbase and pay at most the subsidy plus fees, and every
+// other transaction must be final and spend existing unspent outputs, at most once within the block,
+// with valid scriptSigs.
+func (us *UTXOSet) validateBlockTxs(b *Block, prev *blockNode) error {
+	if len(b.TxData) == 0 {
+		return ErrNoTransactions
+	}
+
+	coinbase := &b.TxData[0]
+	if !coinbase.IsCoinbase {
+		return &TxValidationError{TxID: coinbase.TxID, Err: ErrMissingCoinbase}
+	}
+
+	view := newUTXOView(us, prev)
+	view.connect(coinbase)
+
+	fees := 0
+	for i := 1; i < len(b.TxData); i++ {
+		tx := &b.TxData[i]
+		if tx.IsCoinbase {
+			return &TxValidationError{TxID: tx.TxID, Err: ErrMisplacedCoinbase}
+		}
+
+		fee, err := view.checkTx(tx)
+		if err != nil {
+			return &TxValidationError{TxID: tx.TxID, Err: err}
+		}
+		fees += fee
+		if !inMoneyRange(fees) {
+			return &TxValidationError{TxID: tx.TxID, Err: fmt.Errorf("%w: block fees", ErrValueOutOfRange)}
+		}
+
+		view.connect(tx)
+	}
+
+	if err := checkCoinbase(coinbase, b.Height, fees); err != nil {
+		return &TxValidationError{TxID: coinbase.TxID, Err: err}
+	}
+
+	return nil
+}
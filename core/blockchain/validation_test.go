@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+)
+
+// newTestTx returns a final transaction spending output i of the i-th of prevTxIDs to outputs with the given
+// values, which anyone can spend
+func newTestTx(prevTxIDs []string, values ...int) *Transaction {
+	tx := &Transaction{Version: TxVersion, Timestamp: 1700000000}
+	for i, prev := range prevTxIDs {
+		tx.Inputs = append(tx.Inputs, Input{PrevTxID: prev, OutputIndex: i, Sequence: MaxSequence})
+	}
+	for _, value := range values {
+		tx.Outputs = append(tx.Outputs, Output{Value: value, ScriptPubKey: "51"})
+	}
+	tx.TxID = tx.calculateID()
+	return tx
+}
+
+// newTestCoinbase returns the coinbase of the block at height paying the given values
+func newTestCoinbase(height uint64, values ...int) *Transaction {
+	tx := newTestTx(nil, values...)
+	tx.IsCoinbase = true
+	tx.Inputs = []Input{coinbaseInput(height)}
+	tx.TxID = tx.calculateID()
+	return tx
+}
+
+func TestCheckTxSanityValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		err    error
+	}{
+		{"single output", []int{10}, nil},
+		{"max supply", []int{MaxSupply}, nil},
+		{"negative output", []int{-1}, ErrInvalidOutputValue},
+		{"zero output", []int{10, 0}, ErrInvalidOutputValue},
+		{"output above max supply", []int{MaxSupply + 1}, ErrValueOutOfRange},
+		{"total above max supply", []int{MaxSupply, 1}, ErrValueOutOfRange},
+		{"overflowing total", []int{math.MaxInt64, 2}, ErrValueOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTxSanity(newTestTx([]string{"aa"}, tt.values...))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("checkTxSanity() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckTxSanityDataOutput(t *testing.T) {
+	script, err := NullDataScript([]byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := hex.EncodeToString(script)
+
+	tests := []struct {
+		name    string
+		outputs []Output
+		err     error
+	}{
+		{"zero value data output", []Output{{Value: 10, ScriptPubKey: "51"}, {Value: 0, ScriptPubKey: data}}, nil},
+		{"data output carrying value", []Output{{Value: 1, ScriptPubKey: data}}, ErrInvalidDataOutput},
+		{"zero value spendable output", []Output{{Value: 0, ScriptPubKey: "51"}, {Value: 0, ScriptPubKey: data}}, ErrInvalidOutputValue},
+		{"two data outputs", []Output{{Value: 0, ScriptPubKey: data}, {Value: 0, ScriptPubKey: data}}, ErrInvalidDataOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := newTestTx([]string{"aa"})
+			tx.Outputs = tt.outputs
+			tx.TxID = tx.calculateID()
+			if err := checkTxSanity(tx); !errors.Is(err, tt.err) {
+				t.Fatalf("checkTxSanity() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckCoinbaseValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		fees   int
+		err    error
+	}{
+		{"subsidy", []int{Subsidy(1)}, 0, nil},
+		{"subsidy and fees", []int{Subsidy(1), 5}, 5, nil},
+		{"above subsidy", []int{Subsidy(1) + 1}, 0, ErrCoinbaseValue},
+		{"overflowing outputs", []int{math.MaxInt64, 2}, 0, ErrValueOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCoinbase(newTestCoinbase(1, tt.values...), 1, tt.fees)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("checkCoinbase() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckTxInputValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []int
+		err    error
+	}{
+		{"input above max supply", []int{math.MaxInt64}, ErrValueOutOfRange},
+		{"overflowing input total", []int{MaxSupply, MaxSupply}, ErrValueOutOfRange},
+		{"insufficient inputs", []int{1}, ErrInsufficientInputs},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newUTXOView(nil, nil)
+			var prevTxIDs []string
+			for i, value := range tt.inputs {
+				prev := newTestCoinbase(uint64(i), value)
+				v.created[outpoint(prev.TxID, i)] = UTXO{TxID: prev.TxID, OutputIndex: i, Value: value, ScriptPubKey: "51"} // OP_1, spendable by anyone
+				prevTxIDs = append(prevTxIDs, prev.TxID)
+			}
+
+			_, err := v.checkTx(newTestTx(prevTxIDs, 2))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("checkTx() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckTxCoinbaseMaturity(t *testing.T) {
+	const created = 5
+
+	tests := []struct {
+		name     string
+		coinbase bool
+		depth    uint64 // blocks between the output and the spending block
+		err      error
+	}{
+		{"coinbase one block short of maturity", true, CoinbaseMaturity - 1, ErrImmatureCoinbase},
+		{"coinbase at maturity", true, CoinbaseMaturity, nil},
+		{"coinbase past maturity", true, CoinbaseMaturity + 1, nil},
+		{"regular output in the next block", false, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := newTestCoinbase(created, 10)
+			v := newUTXOView(nil, nil)
+			v.height = created + tt.depth
+			v.created[outpoint(prev.TxID, 0)] = UTXO{TxID: prev.TxID, Value: 10, ScriptPubKey: "51", Height: created, IsCoinbase: tt.coinbase}
+
+			if _, err := v.checkTx(newTestTx([]string{prev.TxID}, 9)); !errors.Is(err, tt.err) {
+				t.Fatalf("checkTx() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
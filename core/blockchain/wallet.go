@@ -4,46 +4,136 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"encoding/gob"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/shu8h0-null/minbit/core/config"
 )
 
+// Keys of HD wallets follow the BIP32 wallet layout: receiving addresses are derived on the
+// external chain m/0'/0/i and change addresses on the internal chain m/0'/1/i.
+const (
+	externalChain = 0
+	internalChain = 1
+
+	// GapLimit is the number of unused keys the keypool holds ahead on each chain.
+	// Outputs paying to addresses further ahead are not recognised by the wallet.
+	GapLimit = 20
+)
+
+// accountPath is the path of the account whose chains HD wallets derive their keys on
+var accountPath = []uint32{HardenedKeyStart}
+
+var ErrNotHDWallet = errors.New("single-key wallet has no seed to derive keys from")
+
+// Wallet holds the keys of a wallet. Its keypool is public, so that a locked wallet still
+// recognises and hands out its addresses, while the secrets the private keys are derived
+// from are only held while the wallet is unlocked.
 type Wallet struct {
 	Id         string
-	PrivateKey *ecdsa.PrivateKey
+	PrivateKey *ecdsa.PrivateKey // key of the default address, nil while the wallet is locked
 	PublicKey  *ecdsa.PublicKey
-	Address    string
+	Address    string // first receiving address, or the only address of a single-key wallet
+
+	secrets   *walletSecrets              // nil while the wallet is locked
+	crypt     *walletCrypt                // encrypted secrets, nil for plaintext wallets
+	lockTimer *time.Timer                 // locks the wallet once the unlock timeout expires
+	chainKeys [2]*ExtendedKey             // public keys of the external and internal chain, nil for single-key wallets
+	next      [2]uint32                   // next unused index on the external and internal chain
+	chains    [2][]string                 // keypool addresses of each chain, derived GapLimit keys beyond next
+	pubKeys   map[string]*ecdsa.PublicKey // keypool by address
+	paths     map[string][2]uint32        // chain and index of the keypool addresses of HD wallets
+	outputs   map[string]UTXO             // unspent outputs of the wallet on the main chain by outpoint
+	history   []WalletTx                  // transactions of the wallet on the main chain, oldest first
+	synced    int                         // height of the last block applied to outputs and history, -1 if none
+	syncedTip string                      // hash of the last block applied
+	mu        sync.Mutex
+}
+
+// walletSecrets are the secrets of a wallet, which are encrypted in the wallet file of encrypted wallets.
+// HD wallets hold their seed and the mnemonic it was derived from, if any, single-key wallets their key.
+type walletSecrets struct {
+	Mnemonic string
+	Seed     []byte
+	Key      *big.Int
+
+	account *ExtendedKey // key at accountPath, derived from Seed
 }
 
 type serializableKey struct {
 	D, X, Y *big.Int
 }
 
+type serializableExtendedKey struct {
+	X, Y      *big.Int
+	ChainCode []byte
+	Depth     uint8
+}
+
+// serializableWallet is the saved form of a wallet. Plaintext HD wallets save their seed and
+// single-key wallets their key. Encrypted wallets save their secrets in Crypt instead, along
+// with the public keys of their chains or their public key, so that they load locked.
+// Every HD wallet saves how far its chains are used.
 type serializableWallet struct {
-	Id      string
-	Key     serializableKey
-	Address string
+	Id        string
+	Key       serializableKey
+	Address   string
+	Mnemonic  string
+	Seed      []byte
+	Next      [2]uint32
+	ChainKeys [2]serializableExtendedKey
+	Crypt     *walletCrypt
 }
 
-// NewWallet generates a new wallet.
-func NewWallet(id string) (*Wallet, error) {
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// NewWallet generates a new HD wallet from the words of a random mnemonic, which together with
+// the optional mnemonic passphrase back up the wallet. Unless walletPassphrase is empty, the
+// wallet is encrypted with it. The wallet is returned unlocked, so that its words can be shown
+// with Mnemonic, and encrypted wallets should be locked after.
+func NewWallet(id, mnemonicPassphrase, walletPassphrase string) (*Wallet, error) {
+	mnemonic, err := newMnemonic()
 	if err != nil {
-		return nil, fmt.Errorf("Error generating private key for wallet: %v", err)
+		return nil, err
+	}
+	seed, err := mnemonicSeed(mnemonic, mnemonicPassphrase)
+	if err != nil {
+		return nil, err
 	}
+	return newWalletFromMnemonic(id, mnemonic, seed, walletPassphrase)
+}
+
+// NewWalletFromSeed creates and saves the HD wallet spanned by seed, encrypted with walletPassphrase
+// unless it is empty. The first receiving address is the default address of the wallet, so NewAddress
+// hands out addresses after it.
+func NewWalletFromSeed(id string, seed []byte, walletPassphrase string) (*Wallet, error) {
+	return newWalletFromMnemonic(id, "", seed, walletPassphrase)
+}
 
-	wallet, err := ConstructWallet(id, privateKey)
+// newWalletFromMnemonic creates and saves the HD wallet spanned by seed, derived from mnemonic
+func newWalletFromMnemonic(id, mnemonic string, seed []byte, walletPassphrase string) (*Wallet, error) {
+	account, err := accountKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := newHDWallet(id, chainKeys(account), [2]uint32{1, 0})
 	if err != nil {
 		return nil, err
 	}
+	if err := wallet.setSecrets(&walletSecrets{Mnemonic: mnemonic, Seed: bytes.Clone(seed)}); err != nil {
+		return nil, err
+	}
 
+	if walletPassphrase != "" {
+		if err := wallet.encrypt(walletPassphrase); err != nil {
+			return nil, err
+		}
+	}
 	if err := wallet.Save(); err != nil {
 		return nil, fmt.Errorf("failed to save wallet: %w", err)
 	}
@@ -51,22 +141,231 @@ func NewWallet(id string) (*Wallet, error) {
 	return wallet, nil
 }
 
-// ConstructWallet contructs an Wallet from a given *ecdsa.PrivateKey
+// accountKey derives the key at accountPath from seed
+func accountKey(seed []byte) (*ExtendedKey, error) {
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	return master.Derive(accountPath)
+}
+
+// chainKeys returns the public keys of the external and internal chain of account
+func chainKeys(account *ExtendedKey) [2]*ExtendedKey {
+	var keys [2]*ExtendedKey
+	for chain := range keys {
+		// Children of the account are non-hardened, and the depth of the account keeps them from
+		// exceeding the maximum depth, so the derivation cannot fail.
+		key, _ := account.Child(uint32(chain))
+		keys[chain] = key.Public()
+	}
+	return keys
+}
+
+// newHDWallet creates the locked HD wallet whose chains have the public keys chainKeys and are used up to next
+func newHDWallet(id string, chainKeys [2]*ExtendedKey, next [2]uint32) (*Wallet, error) {
+	wallet := &Wallet{
+		Id:        id,
+		chainKeys: chainKeys,
+		next:      next,
+		pubKeys:   make(map[string]*ecdsa.PublicKey),
+		paths:     make(map[string][2]uint32),
+	}
+	wallet.resetSync()
+	for chain := range wallet.chains {
+		if err := wallet.topUp(uint32(chain)); err != nil {
+			return nil, err
+		}
+	}
+
+	wallet.Address = wallet.chains[externalChain][0]
+	wallet.PublicKey = wallet.pubKeys[wallet.Address]
+	return wallet, nil
+}
+
+// ConstructWallet contructs a single-key Wallet from a given *ecdsa.PrivateKey
 func ConstructWallet(id string, privKey *ecdsa.PrivateKey) (*Wallet, error) {
-	publicKey := &privKey.PublicKey
-	pubKeyHash, err := PublicKeyToPubKeyHash(publicKey)
+	wallet, err := newSingleKeyWallet(id, &privKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := wallet.setSecrets(&walletSecrets{Key: privKey.D}); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// newSingleKeyWallet creates the locked single-key wallet of pubKey
+func newSingleKeyWallet(id string, pubKey *ecdsa.PublicKey) (*Wallet, error) {
+	address, err := keyAddress(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := &Wallet{
+		Id:        id,
+		PublicKey: pubKey,
+		Address:   address,
+		pubKeys:   map[string]*ecdsa.PublicKey{address: pubKey},
+	}
+	wallet.resetSync()
+	return wallet, nil
+}
+
+// keyAddress returns the pay-to-pubkey-hash address of key
+func keyAddress(key *ecdsa.PublicKey) (string, error) {
+	pubKeyHash, err := PublicKeyToPubKeyHash(key)
+	if err != nil {
+		return "", err
+	}
+	return PubKeyHashToAddress(pubKeyHash), nil
+}
+
+// setSecrets makes the secrets of the wallet available, unlocking its private keys
+func (wallet *Wallet) setSecrets(secrets *walletSecrets) error {
+	if !wallet.IsHD() {
+		wallet.PrivateKey = &ecdsa.PrivateKey{PublicKey: *wallet.PublicKey, D: secrets.Key}
+		wallet.secrets = secrets
+		return nil
+	}
+
+	account, err := accountKey(secrets.Seed)
+	if err != nil {
+		return err
+	}
+	if chainKeys(account)[externalChain].x.Cmp(wallet.chainKeys[externalChain].x) != 0 {
+		return errors.New("wallet seed does not match the keys of the wallet")
+	}
+	key, err := account.Derive([]uint32{externalChain, 0})
+	if err != nil {
+		return err
+	}
+	secrets.account = account
+	wallet.PrivateKey = key.PrivateKey()
+	wallet.secrets = secrets
+	return nil
+}
+
+// IsHD reports whether the wallet derives its keys from a seed
+func (wallet *Wallet) IsHD() bool {
+	return wallet.chainKeys[externalChain] != nil
+}
+
+// topUp derives keys on chain until the keypool holds GapLimit keys beyond the next unused one
+func (wallet *Wallet) topUp(chain uint32) error {
+	for uint32(len(wallet.chains[chain])) < wallet.next[chain]+GapLimit {
+		index := uint32(len(wallet.chains[chain]))
+		key, err := wallet.chainKeys[chain].Child(index)
+		if err != nil {
+			return fmt.Errorf("Error deriving key %d of chain %d: %v", index, chain, err)
+		}
+		pubKey := key.PublicKey()
+		address, err := keyAddress(pubKey)
+		if err != nil {
+			return err
+		}
+		wallet.chains[chain] = append(wallet.chains[chain], address)
+		wallet.pubKeys[address] = pubKey
+		wallet.paths[address] = [2]uint32{chain, index}
+	}
+	return nil
+}
+
+// nextAddress hands out the next unused address of chain and saves the wallet
+func (wallet *Wallet) nextAddress(chain uint32) (string, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if !wallet.IsHD() {
+		return "", ErrNotHDWallet
+	}
+
+	address := wallet.chains[chain][wallet.next[chain]]
+	wallet.next[chain]++
+	if err := wallet.topUp(chain); err != nil {
+		return "", err
+	}
+	if err := wallet.save(); err != nil {
+		return "", fmt.Errorf("failed to save wallet: %w", err)
+	}
+	return address, nil
+}
+
+// NewAddress returns a fresh receiving address from the keypool. Locked wallets hand out addresses too.
+func (wallet *Wallet) NewAddress() (string, error) {
+	return wallet.nextAddress(externalChain)
+}
+
+// changeAddress returns the address change is paid back to. HD wallets use a fresh address
+// of the internal chain, single-key wallets their only address.
+func (wallet *Wallet) changeAddress() (string, error) {
+	if !wallet.IsHD() {
+		return wallet.Address, nil
+	}
+	return wallet.nextAddress(internalChain)
+}
+
+// DeriveKey derives the key at path, such as m/0'/0/5, from the seed of the wallet
+func (wallet *Wallet) DeriveKey(path string) (*ecdsa.PrivateKey, error) {
+	if !wallet.IsHD() {
+		return nil, ErrNotHDWallet
+	}
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
 
+	if wallet.secrets == nil {
+		return nil, ErrWalletLocked
+	}
+	master, err := NewMasterKey(wallet.secrets.Seed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.Derive(indexes)
 	if err != nil {
 		return nil, err
 	}
-	address := PubKeyHashToAddress(pubKeyHash)
+	return key.PrivateKey(), nil
+}
+
+// Addresses returns the addresses of every key in the keypool, including the unused keys
+// within the gap limit, so that payments to any of them are recognised
+func (wallet *Wallet) Addresses() []string {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	addresses := make([]string, 0, len(wallet.pubKeys))
+	for address := range wallet.pubKeys {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// key returns the private key of address, which must be in the keypool. It fails while the wallet is locked.
+func (wallet *Wallet) key(address string) (*ecdsa.PrivateKey, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if _, exists := wallet.pubKeys[address]; !exists {
+		return nil, fmt.Errorf("no key for address %s", address)
+	}
+	if wallet.secrets == nil {
+		return nil, ErrWalletLocked
+	}
+	if !wallet.IsHD() {
+		return wallet.PrivateKey, nil
+	}
 
-	return &Wallet{
-		Id:         id,
-		PrivateKey: privKey,
-		PublicKey:  publicKey,
-		Address:    address,
-	}, nil
+	path := wallet.paths[address]
+	key, err := wallet.secrets.account.Derive(path[:])
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey(), nil
 }
 
 func (wallet *Wallet) Save() error {
@@ -74,22 +373,45 @@ func (wallet *Wallet) Save() error {
 		return errors.New("wallet not initialized")
 	}
 
-	walletDir := filepath.Join(config.WalletDir(), wallet.Id)
-	walletFile := filepath.Join(walletDir, "wallet.dat")
-	if err := os.MkdirAll(walletDir, 0700); err != nil {
-		return err
-	}
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	return wallet.save()
+}
+
+// walletFile returns the path of the file the wallet with the given id is saved to
+func walletFile(id string) string {
+	return filepath.Join(config.WalletDir(), id, "wallet.dat")
+}
 
-	key := serializableKey{
-		D: wallet.PrivateKey.D,
-		X: wallet.PrivateKey.PublicKey.X,
-		Y: wallet.PrivateKey.PublicKey.Y,
+func (wallet *Wallet) save() error {
+	path := walletFile(wallet.Id)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
 	}
 
 	sw := serializableWallet{
 		Id:      wallet.Id,
-		Key:     key,
 		Address: wallet.Address,
+		Next:    wallet.next,
+		Crypt:   wallet.crypt,
+	}
+	switch {
+	case wallet.crypt != nil && wallet.IsHD():
+		for chain, key := range wallet.chainKeys {
+			sw.ChainKeys[chain] = serializableExtendedKey{X: key.x, Y: key.y, ChainCode: key.chainCode, Depth: key.depth}
+		}
+	case wallet.crypt != nil:
+		sw.Key = serializableKey{X: wallet.PublicKey.X, Y: wallet.PublicKey.Y}
+	case wallet.IsHD():
+		sw.Mnemonic = wallet.secrets.Mnemonic
+		sw.Seed = wallet.secrets.Seed
+	default:
+		sw.Key = serializableKey{
+			D: wallet.secrets.Key,
+			X: wallet.PublicKey.X,
+			Y: wallet.PublicKey.Y,
+		}
 	}
 
 	var buf bytes.Buffer
@@ -98,13 +420,15 @@ func (wallet *Wallet) Save() error {
 		return err
 	}
 
-	return os.WriteFile(walletFile, buf.Bytes(), 0600)
+	return os.WriteFile(path, buf.Bytes(), 0600)
 }
 
-// LoadWallet load wallet with the given id
+// LoadWallet load wallet with the given id. Encrypted wallets load locked. Wallets saved before
+// HD wallets were introduced load as single-key wallets, and wallets saved before encryption was
+// introduced load as plaintext wallets, which IsEncrypted reports so that they can be migrated
+// with Encrypt.
 func LoadWallet(id string) (*Wallet, error) {
-	path := filepath.Join(config.WalletDir(), id, "wallet.dat")
-	data, err := os.ReadFile(path)
+	data, err := os.ReadFile(walletFile(id))
 	if err != nil {
 		return nil, err
 	}
@@ -115,23 +439,190 @@ func LoadWallet(id string) (*Wallet, error) {
 		return nil, fmt.Errorf("failed to decode wallet: %w", err)
 	}
 
-	curve := elliptic.P256()
+	var wallet *Wallet
+	switch {
+	case encoded.Crypt != nil && encoded.ChainKeys[externalChain].ChainCode != nil:
+		var keys [2]*ExtendedKey
+		for chain, key := range encoded.ChainKeys {
+			keys[chain] = &ExtendedKey{x: key.X, y: key.Y, chainCode: key.ChainCode, depth: key.Depth}
+		}
+		wallet, err = newHDWallet(encoded.Id, keys, encoded.Next)
+	case encoded.Crypt != nil:
+		wallet, err = newSingleKeyWallet(encoded.Id, &ecdsa.PublicKey{Curve: elliptic.P256(), X: encoded.Key.X, Y: encoded.Key.Y})
+	case len(encoded.Seed) > 0:
+		var account *ExtendedKey
+		if account, err = accountKey(encoded.Seed); err != nil {
+			return nil, err
+		}
+		if wallet, err = newHDWallet(encoded.Id, chainKeys(account), encoded.Next); err != nil {
+			return nil, err
+		}
+		err = wallet.setSecrets(&walletSecrets{Mnemonic: encoded.Mnemonic, Seed: encoded.Seed})
+	default:
+		wallet, err = ConstructWallet(encoded.Id, &ecdsa.PrivateKey{
+			D: encoded.Key.D,
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     encoded.Key.X,
+				Y:     encoded.Key.Y,
+			},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.Address != encoded.Address {
+		return nil, fmt.Errorf("wallet keys do not match its address %s", encoded.Address)
+	}
+	wallet.crypt = encoded.Crypt
+	return wallet, nil
+}
+
+// ArchiveWallet moves the saved wallet with the given id aside, so that a restored wallet
+// can be saved in its place. It returns the path the wallet was moved to.
+func ArchiveWallet(id string) (string, error) {
+	path := walletFile(id)
+	archived := fmt.Sprintf("%s.old-%d", path, time.Now().Unix())
+	if err := os.Rename(path, archived); err != nil {
+		return "", fmt.Errorf("failed to archive wallet: %w", err)
+	}
+	return archived, nil
+}
+
+// UTXOSource provides the outputs of an address that the next block can spend.
+// The ChainState is a UTXOSource for the utxo set at its tip.
+type UTXOSource interface {
+	SpendableUTXOs(address string) []UTXO
+}
 
-	priv := &ecdsa.PrivateKey{
-		D: encoded.Key.D,
-		PublicKey: ecdsa.PublicKey{
-			Curve: curve,
-			X:     encoded.Key.X,
-			Y:     encoded.Key.Y,
-		},
+// CreateTransaction creates a transaction paying amount to recipient from the outputs of the wallet.
+// The inputs are selected from utxoSet, any value beyond amount and the fee is returned to the wallet
+// in a change output, and every input is signed with the wallet key. See fundTransaction for fee and feeRate.
+func (wallet *Wallet) CreateTransaction(utxoSet UTXOSource, recipient string, amount, fee, feeRate int) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, errors.New("amount to send must be positive")
 	}
+	recipScript, err := AddressToScriptPubKey(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid recipent address: %v", err)
+	}
+
+	tx, spent, err := wallet.fundTransaction(utxoSet, []Output{{Value: amount, ScriptPubKey: recipScript}}, fee, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	tx.Recipent = recipient
+	tx.Amount = amount
 
-	pub := &priv.PublicKey
+	if err := wallet.signInputs(tx, spent); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
 
-	return &Wallet{
-		Id:         encoded.Id,
-		PrivateKey: priv,
-		PublicKey:  pub,
-		Address:    encoded.Address,
-	}, nil
+// fundTransaction creates an unsigned transaction with the given outputs, spending enough outputs
+// of the wallet to cover them and the fee. The remaining value is paid back to the wallet.
+// The fee is fee, unless feeRate is positive, in which case it is estimated with EstimateFee to pay
+// feeRate per byte for the selected inputs and the outputs along with a change output.
+// It also returns the outputs spent by the inputs of the transaction, in input order.
+func (wallet *Wallet) fundTransaction(utxoSet UTXOSource, outputs []Output, fee, feeRate int) (*Transaction, []UTXO, error) {
+	if fee < 0 {
+		return nil, nil, errors.New("fee must not be negative")
+	}
+	if feeRate < 0 {
+		return nil, nil, errors.New("fee rate must not be negative")
+	}
+	if wallet.IsLocked() {
+		return nil, nil, ErrWalletLocked
+	}
+	outputSum := 0
+	for _, output := range outputs {
+		outputSum += output.Value
+	}
+
+	var utxos []UTXO
+	for _, address := range wallet.Addresses() {
+		utxos = append(utxos, utxoSet.SpendableUTXOs(address)...)
+	}
+
+	// selecting more inputs raises the estimated fee, which may need more inputs again
+	if feeRate > 0 {
+		fee = EstimateFee(feeRate, 1, len(outputs)+1)
+	}
+	var inputs []Input
+	for {
+		var err error
+		inputs, err = ResolveInputs(utxos, outputSum+fee)
+		if err != nil {
+			return nil, nil, err
+		}
+		if feeRate == 0 {
+			break
+		}
+		estimated := EstimateFee(feeRate, len(inputs), len(outputs)+1)
+		if estimated <= fee {
+			break
+		}
+		fee = estimated
+	}
+	target := outputSum + fee
+
+	byOutpoint := make(map[string]UTXO, len(utxos))
+	for _, utxo := range utxos {
+		byOutpoint[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+	spent := make([]UTXO, len(inputs))
+	inputSum := 0
+	for i, input := range inputs {
+		spent[i] = byOutpoint[outpoint(input.PrevTxID, input.OutputIndex)]
+		inputSum += spent[i].Value
+	}
+
+	if change := inputSum - target; change > 0 {
+		changeAddr, err := wallet.changeAddress()
+		if err != nil {
+			return nil, nil, err
+		}
+		changeScript, err := AddressToScriptPubKey(changeAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid change address: %v", err)
+		}
+		outputs = append(outputs, Output{Value: change, ScriptPubKey: changeScript})
+	}
+
+	return &Transaction{
+		Version:   TxVersion,
+		Sender:    wallet.Address,
+		Recipent:  wallet.Address,
+		Inputs:    inputs,
+		Outputs:   outputs,
+		Timestamp: time.Now().Unix(),
+	}, spent, nil
+}
+
+// signInputs signs every input of tx, spending the output of spent at the same index, with SigHashAll
+// and the wallet key of the address the output pays to, and sets its pay-to-pubkey-hash scriptSig
+func (wallet *Wallet) signInputs(tx *Transaction, spent []UTXO) error {
+	if len(spent) != len(tx.Inputs) {
+		return errors.New("spent outputs do not match the inputs of the transaction")
+	}
+	for i := range tx.Inputs {
+		address, err := ScriptPubKeyToAddress(spent[i].ScriptPubKey)
+		if err != nil {
+			return fmt.Errorf("Cannot sign input %d: %v", i, err)
+		}
+		key, err := wallet.key(address)
+		if err != nil {
+			return fmt.Errorf("Cannot sign input %d: %w", i, err)
+		}
+
+		sig, err := tx.SignInput(i, spent[i], SigHashAll, key)
+		if err != nil {
+			return fmt.Errorf("Error signing input %d: %v", i, err)
+		}
+		pubKey := elliptic.Marshal(elliptic.P256(), key.PublicKey.X, key.PublicKey.Y)
+		tx.Inputs[i].ScriptSig = hex.EncodeToString(CreateScriptSig(sig, pubKey))
+	}
+	return nil
 }
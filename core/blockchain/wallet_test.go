@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// testUTXOSource serves the utxos it holds as spendable by the addresses they pay to
+type testUTXOSource map[string][]UTXO
+
+func (s testUTXOSource) SpendableUTXOs(address string) []UTXO {
+	return s[address]
+}
+
+// newTestWallet creates an unencrypted HD wallet saved under a temporary home directory
+func newTestWallet(t *testing.T) *Wallet {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	wallet, err := NewWallet("test", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+// fundTestWallet returns a source holding one output paying each of the values to the wallet address
+func fundTestWallet(t *testing.T, wallet *Wallet, values ...int) testUTXOSource {
+	t.Helper()
+	script, err := AddressToScriptPubKey(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var utxos []UTXO
+	for i, value := range values {
+		prev := newTestCoinbase(uint64(i), value)
+		utxos = append(utxos, UTXO{TxID: prev.TxID, Value: value, ScriptPubKey: script, Height: uint64(i)})
+	}
+	return testUTXOSource{wallet.Address: utxos}
+}
+
+func TestFundTransactionFee(t *testing.T) {
+	recipient := newTestWallet(t)
+	wallet := newTestWallet(t)
+	source := fundTestWallet(t, wallet, 1000, 1000, 1000, 1000, 1000)
+
+	tests := []struct {
+		name    string
+		amount  int
+		fee     int
+		feeRate int
+		wantFee int
+	}{
+		{"absolute fee", 1500, 7, 0, 7},
+		{"fee rate", 1500, 0, 1, EstimateFee(1, 3, 2)},
+		{"fee rate overrides fee", 1500, 7, 1, EstimateFee(1, 3, 2)},
+		{"fee rate needing more inputs", 500, 0, 2, EstimateFee(2, 4, 2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := wallet.CreateTransaction(source, recipient.Address, tt.amount, tt.fee, tt.feeRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fee := 1000*len(tx.Inputs) - tx.OutputSum()
+			if fee != tt.wantFee {
+				t.Fatalf("fee = %d, want %d", fee, tt.wantFee)
+			}
+			if tt.feeRate > 0 && fee < EstimateFee(tt.feeRate, len(tx.Inputs), len(tx.Outputs)) {
+				t.Fatalf("fee %d does not reach fee rate %d", fee, tt.feeRate)
+			}
+		})
+	}
+
+	if _, err := wallet.CreateTransaction(source, recipient.Address, 1500, 0, 100); err == nil {
+		t.Fatal("funded a fee rate the wallet cannot afford")
+	}
+}
+
+func TestCreateTransactionUnlocksInputs(t *testing.T) {
+	recipient := newTestWallet(t)
+	wallet := newTestWallet(t)
+	change, err := wallet.NewAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := fundTestWallet(t, wallet, 30, 40)
+	changeSource := fundTestWallet(t, wallet, 50)
+	for i := range changeSource[wallet.Address] {
+		utxo := &changeSource[wallet.Address][i]
+		utxo.ScriptPubKey, _ = AddressToScriptPubKey(change)
+		utxo.Height = 10
+	}
+	source[change] = changeSource[wallet.Address]
+
+	tx, err := wallet.CreateTransaction(source, recipient.Address, 100, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Inputs) != 3 {
+		t.Fatalf("transaction spends %d inputs, want 3", len(tx.Inputs))
+	}
+
+	spent := make(map[string]UTXO)
+	for _, utxos := range source {
+		for _, utxo := range utxos {
+			spent[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+		}
+	}
+	view := newUTXOView(nil, nil)
+	for i, input := range tx.Inputs {
+		utxo := spent[outpoint(input.PrevTxID, input.OutputIndex)]
+		if err := UnlockUTXO(tx, i, utxo); err != nil {
+			t.Fatalf("input %d does not unlock its output: %v", i, err)
+		}
+		view.created[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+	view.height = 20
+	if fee, err := view.checkTx(tx); err != nil || fee != 5 {
+		t.Fatalf("checkTx() = %d, %v, want fee 5", fee, err)
+	}
+
+	// a signature does not unlock another input, nor the same input once the transaction changed
+	if err := UnlockUTXO(tx, 0, spent[outpoint(tx.Inputs[1].PrevTxID, tx.Inputs[1].OutputIndex)]); err == nil {
+		t.Fatal("input unlocks an output it does not spend")
+	}
+	tx.Outputs[0].Value++
+	if err := UnlockUTXO(tx, 0, spent[outpoint(tx.Inputs[0].PrevTxID, tx.Inputs[0].OutputIndex)]); err == nil {
+		t.Fatal("signature still valid after changing an output")
+	}
+}
+
+func TestCreateTransactionLockedWallet(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	wallet, err := NewWallet("encrypted", "", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	source := fundTestWallet(t, wallet, 100)
+	if _, err := wallet.CreateTransaction(source, wallet.Address, 10, 1, 0); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("CreateTransaction() = %v, want %v", err, ErrWalletLocked)
+	}
+}
@@ -0,0 +1,246 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Secrets of encrypted wallets are sealed with XChaCha20-Poly1305 under a key derived from the
+// wallet passphrase with argon2id, which is memory-hard to slow down guessing the passphrase.
+// The sealed secrets are bound to the address of the wallet, so they cannot be moved to another
+// wallet file.
+const (
+	kdfTime     = 1
+	kdfMemory   = 64 * 1024 // KiB
+	kdfThreads  = 4
+	kdfSaltSize = 16
+)
+
+var (
+	ErrWalletLocked       = errors.New("wallet is locked")
+	ErrWalletEncrypted    = errors.New("wallet is already encrypted")
+	ErrWalletNotEncrypted = errors.New("wallet is not encrypted")
+	ErrWrongPassphrase    = errors.New("wrong wallet passphrase")
+)
+
+// walletCrypt holds the encrypted secrets of a wallet along with the parameters of the
+// key derivation, which are saved so that they can be raised for new wallets
+type walletCrypt struct {
+	Salt       []byte
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// sealSecrets encrypts secrets with a key derived from passphrase, binding them to address
+func sealSecrets(secrets *walletSecrets, address, passphrase string) (*walletCrypt, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(secrets); err != nil {
+		return nil, err
+	}
+	plaintext := buf.Bytes()
+	defer clear(plaintext)
+
+	crypt := &walletCrypt{
+		Salt:    make([]byte, kdfSaltSize),
+		Time:    kdfTime,
+		Memory:  kdfMemory,
+		Threads: kdfThreads,
+		Nonce:   make([]byte, chacha20poly1305.NonceSizeX),
+	}
+	if _, err := rand.Read(crypt.Salt); err != nil {
+		return nil, fmt.Errorf("Error generating salt for wallet encryption: %v", err)
+	}
+	if _, err := rand.Read(crypt.Nonce); err != nil {
+		return nil, fmt.Errorf("Error generating nonce for wallet encryption: %v", err)
+	}
+
+	aead, err := crypt.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	crypt.Ciphertext = aead.Seal(nil, crypt.Nonce, plaintext, []byte(address))
+	return crypt, nil
+}
+
+// open decrypts the secrets with a key derived from passphrase
+func (crypt *walletCrypt) open(address, passphrase string) (*walletSecrets, error) {
+	aead, err := crypt.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, crypt.Nonce, crypt.Ciphertext, []byte(address))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	defer clear(plaintext)
+
+	var secrets walletSecrets
+	if err := gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode wallet secrets: %w", err)
+	}
+	return &secrets, nil
+}
+
+// cipher returns the AEAD keyed by passphrase
+func (crypt *walletCrypt) cipher(passphrase string) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), crypt.Salt, crypt.Time, crypt.Memory, crypt.Threads, chacha20poly1305.KeySize)
+	defer clear(key)
+	return chacha20poly1305.NewX(key)
+}
+
+// IsEncrypted reports whether the secrets of the wallet are saved encrypted
+func (wallet *Wallet) IsEncrypted() bool {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	return wallet.crypt != nil
+}
+
+// IsLocked reports whether the private keys of the wallet are unavailable until it is unlocked.
+// Plaintext wallets are never locked.
+func (wallet *Wallet) IsLocked() bool {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	return wallet.secrets == nil
+}
+
+// Encrypt encrypts the secrets of a plaintext wallet with passphrase, such as to migrate a wallet
+// saved before encryption was introduced. The wallet is saved and locked.
+func (wallet *Wallet) Encrypt(passphrase string) error {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if err := wallet.encrypt(passphrase); err != nil {
+		return err
+	}
+	if err := wallet.save(); err != nil {
+		return fmt.Errorf("failed to save wallet: %w", err)
+	}
+	wallet.lock()
+	return nil
+}
+
+func (wallet *Wallet) encrypt(passphrase string) error {
+	if wallet.crypt != nil {
+		return ErrWalletEncrypted
+	}
+	if passphrase == "" {
+		return errors.New("wallet passphrase must not be empty")
+	}
+
+	crypt, err := sealSecrets(wallet.secrets, wallet.Address, passphrase)
+	if err != nil {
+		return err
+	}
+	wallet.crypt = crypt
+	return nil
+}
+
+// Unlock decrypts the secrets of an encrypted wallet with passphrase, so that it can spend and sign,
+// until it is locked again once timeout expires
+func (wallet *Wallet) Unlock(passphrase string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("unlock timeout must be positive")
+	}
+
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if wallet.crypt == nil {
+		return ErrWalletNotEncrypted
+	}
+	secrets, err := wallet.crypt.open(wallet.Address, passphrase)
+	if err != nil {
+		return err
+	}
+	if wallet.secrets == nil {
+		if err := wallet.setSecrets(secrets); err != nil {
+			return err
+		}
+	} else {
+		clear(secrets.Seed)
+	}
+
+	if wallet.lockTimer != nil {
+		wallet.lockTimer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		wallet.mu.Lock()
+		defer wallet.mu.Unlock()
+		// a timer replaced by a later unlock may fire before it is stopped
+		if wallet.lockTimer == timer {
+			wallet.lock()
+		}
+	})
+	wallet.lockTimer = timer
+	return nil
+}
+
+// Lock wipes the secrets of an encrypted wallet from memory
+func (wallet *Wallet) Lock() error {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if wallet.crypt == nil {
+		return ErrWalletNotEncrypted
+	}
+	wallet.lock()
+	return nil
+}
+
+func (wallet *Wallet) lock() {
+	if wallet.lockTimer != nil {
+		wallet.lockTimer.Stop()
+		wallet.lockTimer = nil
+	}
+	if wallet.secrets != nil {
+		clear(wallet.secrets.Seed)
+		wallet.secrets = nil
+	}
+	wallet.PrivateKey = nil
+}
+
+// ChangePassphrase encrypts the secrets of an encrypted wallet with newPassphrase instead of
+// oldPassphrase and saves the wallet. The wallet stays locked or unlocked.
+func (wallet *Wallet) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return errors.New("wallet passphrase must not be empty")
+	}
+
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if wallet.crypt == nil {
+		return ErrWalletNotEncrypted
+	}
+	secrets, err := wallet.crypt.open(wallet.Address, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer clear(secrets.Seed)
+
+	crypt, err := sealSecrets(secrets, wallet.Address, newPassphrase)
+	if err != nil {
+		return err
+	}
+	oldCrypt := wallet.crypt
+	wallet.crypt = crypt
+	if err := wallet.save(); err != nil {
+		wallet.crypt = oldCrypt
+		return fmt.Errorf("failed to save wallet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestEncryptedWallet creates an HD wallet encrypted with passphrase and locks it
+func newTestEncryptedWallet(t *testing.T, passphrase string) *Wallet {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	wallet, err := NewWallet("encrypted", "", passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	return wallet
+}
+
+// canSign signs a transaction spending an output of wallet, returning the error signing failed with
+func canSign(t *testing.T, wallet *Wallet) error {
+	t.Helper()
+	_, err := wallet.CreateTransaction(fundTestWallet(t, wallet, 100), wallet.Address, 10, 1, 0)
+	return err
+}
+
+func TestWalletUnlock(t *testing.T) {
+	wallet := newTestEncryptedWallet(t, "passphrase")
+
+	if !wallet.IsEncrypted() || !wallet.IsLocked() {
+		t.Fatal("want the wallet encrypted and locked")
+	}
+	if err := canSign(t, wallet); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("signing with a locked wallet = %v, want %v", err, ErrWalletLocked)
+	}
+	if _, err := wallet.key(wallet.Address); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("key of a locked wallet = %v, want %v", err, ErrWalletLocked)
+	}
+
+	if err := wallet.Unlock("wrong", time.Minute); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock(wrong passphrase) = %v, want %v", err, ErrWrongPassphrase)
+	}
+	if !wallet.IsLocked() {
+		t.Fatal("wallet unlocked with a wrong passphrase")
+	}
+	if err := wallet.Unlock("passphrase", 0); err == nil {
+		t.Fatal("Unlock() accepted a zero timeout")
+	}
+
+	if err := wallet.Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := canSign(t, wallet); err != nil {
+		t.Fatalf("signing with an unlocked wallet = %v", err)
+	}
+	if err := wallet.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := canSign(t, wallet); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("signing after Lock() = %v, want %v", err, ErrWalletLocked)
+	}
+}
+
+func TestWalletUnlockTimeout(t *testing.T) {
+	wallet := newTestEncryptedWallet(t, "passphrase")
+
+	if err := wallet.Unlock("passphrase", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if wallet.IsLocked() {
+		t.Fatal("wallet locked before the timeout")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !wallet.IsLocked() {
+		if time.Now().After(deadline) {
+			t.Fatal("wallet not locked after the timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := canSign(t, wallet); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("signing after the timeout = %v, want %v", err, ErrWalletLocked)
+	}
+}
+
+func TestWalletChangePassphrase(t *testing.T) {
+	wallet := newTestEncryptedWallet(t, "old")
+	if err := wallet.Unlock("old", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	key, err := wallet.key(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wallet.ChangePassphrase("wrong", "new"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("ChangePassphrase(wrong passphrase) = %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := wallet.ChangePassphrase("old", ""); err == nil {
+		t.Fatal("ChangePassphrase() accepted an empty passphrase")
+	}
+	if err := wallet.ChangePassphrase("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if !wallet.IsLocked() {
+		t.Error("ChangePassphrase() unlocked the wallet")
+	}
+
+	// the wallet is saved sealed with the new passphrase only
+	loaded, err := LoadWallet(wallet.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsEncrypted() || !loaded.IsLocked() || loaded.Address != wallet.Address {
+		t.Fatal("want the wallet to load encrypted and locked with the same address")
+	}
+	if err := loaded.Unlock("old", time.Minute); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock(old passphrase) = %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := loaded.Unlock("new", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loaded.key(loaded.Address); err != nil || !got.Equal(key) {
+		t.Fatalf("key after changing the passphrase = %v, want the same key", err)
+	}
+}
+
+func TestWalletEncryptErrors(t *testing.T) {
+	plain := newTestWallet(t)
+	if err := plain.Lock(); !errors.Is(err, ErrWalletNotEncrypted) {
+		t.Errorf("Lock(plaintext wallet) = %v, want %v", err, ErrWalletNotEncrypted)
+	}
+	if err := plain.Unlock("passphrase", time.Minute); !errors.Is(err, ErrWalletNotEncrypted) {
+		t.Errorf("Unlock(plaintext wallet) = %v, want %v", err, ErrWalletNotEncrypted)
+	}
+	if err := plain.Encrypt(""); err == nil {
+		t.Error("Encrypt() accepted an empty passphrase")
+	}
+
+	encrypted := newTestEncryptedWallet(t, "passphrase")
+	if err := encrypted.Encrypt("other"); !errors.Is(err, ErrWalletEncrypted) {
+		t.Errorf("Encrypt(encrypted wallet) = %v, want %v", err, ErrWalletEncrypted)
+	}
+}
+
+func TestLoadLegacyWallet(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := keyAddress(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet file written before HD wallets and encryption were introduced
+	legacy := struct {
+		Id      string
+		Key     serializableKey
+		Address string
+	}{"legacy", serializableKey{D: privateKey.D, X: privateKey.X, Y: privateKey.Y}, address}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	path := walletFile("legacy")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := LoadWallet("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet.Address != address || wallet.IsHD() || wallet.IsEncrypted() || wallet.IsLocked() {
+		t.Fatal("want a plaintext single-key wallet with the saved address")
+	}
+	if err := canSign(t, wallet); err != nil {
+		t.Fatalf("signing with a legacy wallet = %v", err)
+	}
+
+	// migrating the legacy wallet to an encrypted one
+	if err := wallet.Encrypt("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := LoadWallet("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrated.IsEncrypted() || !migrated.IsLocked() || migrated.Address != address {
+		t.Fatal("want the migrated wallet to load encrypted and locked with the same address")
+	}
+	if err := migrated.Unlock("passphrase", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := migrated.key(address); err != nil || !key.Equal(privateKey) {
+		t.Fatalf("key of the migrated wallet = %v, want the legacy key", err)
+	}
+}
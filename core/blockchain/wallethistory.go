@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Wallets track their own unspent outputs and transaction history by applying the blocks of the
+// main chain to them. They are synced to the tip whenever their balance or history is queried,
+// and rescanned from genesis when the chain reorganized below the last block they applied.
+
+// WalletTx is a transaction of the main chain paying to or spending from a wallet
+type WalletTx struct {
+	TxID      string `json:"txid"`
+	BlockHash string `json:"block_hash"`
+	Height    uint64 `json:"height"`
+	Timestamp int64  `json:"timestamp"` // time of the block including the transaction
+	Coinbase  bool   `json:"coinbase"`
+	Received  int    `json:"received"` // value of the outputs paying to the wallet
+	Sent      int    `json:"sent"`     // value of the wallet outputs spent
+}
+
+// resetSync forgets the outputs and history of the wallet, so that the next sync starts at genesis
+func (wallet *Wallet) resetSync() {
+	wallet.outputs = make(map[string]UTXO)
+	wallet.history = nil
+	wallet.synced = -1
+	wallet.syncedTip = ""
+}
+
+// Sync applies the blocks of the main chain the wallet has not seen yet to its outputs and history
+func (wallet *Wallet) Sync(bc *Blockchain) error {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	return wallet.sync(bc)
+}
+
+func (wallet *Wallet) sync(bc *Blockchain) error {
+	if wallet.synced >= 0 {
+		if height, ok := bc.MainChainHeight(wallet.syncedTip); !ok || height != uint64(wallet.synced) {
+			wallet.resetSync()
+		}
+	}
+
+	next := wallet.next
+	if err := bc.ForEachBlock(uint64(wallet.synced+1), wallet.applyBlock); err != nil {
+		return err
+	}
+
+	if wallet.next != next {
+		if err := wallet.save(); err != nil {
+			return fmt.Errorf("failed to save wallet: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyBlock records the transactions of b paying to or spending from the wallet. Outputs paying to
+// keys of the keypool mark the keys up to them as used and top up the keypool beyond them, so that
+// a restored wallet recognises every address handed out before, and NewAddress does not hand them out again.
+func (wallet *Wallet) applyBlock(b *Block) error {
+	for _, tx := range b.TxData {
+		wtx := WalletTx{
+			TxID:      tx.TxID,
+			BlockHash: b.Hash,
+			Height:    b.Height,
+			Timestamp: b.Timestamp,
+			Coinbase:  tx.IsCoinbase,
+		}
+
+		if !tx.IsCoinbase {
+			for _, input := range tx.Inputs {
+				key := outpoint(input.PrevTxID, input.OutputIndex)
+				if utxo, exists := wallet.outputs[key]; exists {
+					wtx.Sent += utxo.Value
+					delete(wallet.outputs, key)
+				}
+			}
+		}
+
+		for _, utxo := range tx.UTXOs(b.Height) {
+			address, err := ScriptPubKeyToAddress(utxo.ScriptPubKey)
+			if err != nil {
+				continue
+			}
+			if _, exists := wallet.pubKeys[address]; !exists {
+				continue
+			}
+			wtx.Received += utxo.Value
+			wallet.outputs[outpoint(utxo.TxID, utxo.OutputIndex)] = utxo
+
+			if err := wallet.markUsed(address); err != nil {
+				return err
+			}
+		}
+
+		if wtx.Received > 0 || wtx.Sent > 0 {
+			wallet.history = append(wallet.history, wtx)
+		}
+	}
+
+	wallet.synced = int(b.Height)
+	wallet.syncedTip = b.Hash
+	return nil
+}
+
+// markUsed marks the keys of the chain of address up to it as used
+func (wallet *Wallet) markUsed(address string) error {
+	path, exists := wallet.paths[address]
+	if !exists {
+		return nil
+	}
+	chain, index := path[0], path[1]
+	if index < wallet.next[chain] {
+		return nil
+	}
+	wallet.next[chain] = index + 1
+	return wallet.topUp(chain)
+}
+
+// Rescan rebuilds the outputs and history of the wallet from the main chain, such as after the
+// wallet was restored. It returns the number of transactions found.
+func (wallet *Wallet) Rescan(bc *Blockchain) (int, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	wallet.resetSync()
+	if err := wallet.sync(bc); err != nil {
+		return 0, err
+	}
+	return len(wallet.history), nil
+}
+
+// Balance syncs the wallet and returns the value of its outputs, split by whether the next block can spend them
+func (wallet *Wallet) Balance(bc *Blockchain) (Balance, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if err := wallet.sync(bc); err != nil {
+		return Balance{}, err
+	}
+
+	var bal Balance
+	height := uint64(wallet.synced + 1)
+	for _, utxo := range wallet.outputs {
+		if utxo.IsMature(height) {
+			bal.Spendable += utxo.Value
+		} else {
+			bal.Immature += utxo.Value
+		}
+	}
+	return bal, nil
+}
+
+// History syncs the wallet and returns its transactions on the main chain, oldest first
+func (wallet *Wallet) History(bc *Blockchain) ([]WalletTx, error) {
+	wallet.mu.Lock()
+	defer wallet.mu.Unlock()
+
+	if err := wallet.sync(bc); err != nil {
+		return nil, err
+	}
+	return slices.Clone(wallet.history), nil
+}
@@ -0,0 +1,177 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/shu8h0-null/minbit/core/config"
+)
+
+var (
+	ErrInvalidWalletName = errors.New("invalid wallet name")
+	ErrWalletExists      = errors.New("wallet already exists")
+	ErrWalletLoaded      = errors.New("wallet is already loaded")
+	ErrWalletNotLoaded   = errors.New("wallet is not loaded")
+)
+
+// WalletInfo describes a wallet saved under config.WalletDir()
+type WalletInfo struct {
+	Name   string `json:"name"`
+	Loaded bool   `json:"loaded"`
+}
+
+// WalletManager manages the named wallets of a node, which are saved under config.WalletDir().
+// Loaded wallets are synced to the main chain of the manager when they are loaded or restored.
+type WalletManager struct {
+	bc      *Blockchain
+	wallets map[string]*Wallet
+	mu      sync.Mutex
+}
+
+func NewWalletManager(bc *Blockchain) *WalletManager {
+	return &WalletManager{
+		bc:      bc,
+		wallets: make(map[string]*Wallet),
+	}
+}
+
+// checkWalletName rejects names that are not a single path element
+func checkWalletName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidWalletName, name)
+	}
+	return nil
+}
+
+// walletExists reports whether a wallet is saved under name
+func walletExists(name string) (bool, error) {
+	_, err := os.Stat(walletFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateWallet creates, saves and loads a new HD wallet named name. See NewWallet for the passphrases.
+// The wallet is returned unlocked, so that its words can be shown, and encrypted wallets should be locked after.
+func (wm *WalletManager) CreateWallet(name, mnemonicPassphrase, walletPassphrase string) (*Wallet, error) {
+	return wm.addWallet(name, func() (*Wallet, error) {
+		return NewWallet(name, mnemonicPassphrase, walletPassphrase)
+	})
+}
+
+// RestoreWallet restores, saves and loads the wallet named name from mnemonic, and rescans the main chain
+// for its outputs. See RestoreWallet for the passphrases.
+func (wm *WalletManager) RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase string) (*Wallet, error) {
+	return wm.addWallet(name, func() (*Wallet, error) {
+		return RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase)
+	})
+}
+
+// addWallet loads the wallet created by newWallet, which must not exist yet
+func (wm *WalletManager) addWallet(name string, newWallet func() (*Wallet, error)) (*Wallet, error) {
+	if err := checkWalletName(name); err != nil {
+		return nil, err
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	exists, err := walletExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrWalletExists, name)
+	}
+
+	wallet, err := newWallet()
+	if err != nil {
+		return nil, err
+	}
+	if err := wallet.Sync(wm.bc); err != nil {
+		return nil, err
+	}
+	wm.wallets[name] = wallet
+	return wallet, nil
+}
+
+// LoadWallet loads the wallet saved under name and syncs it to the main chain
+func (wm *WalletManager) LoadWallet(name string) (*Wallet, error) {
+	if err := checkWalletName(name); err != nil {
+		return nil, err
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	if _, loaded := wm.wallets[name]; loaded {
+		return nil, fmt.Errorf("%w: %s", ErrWalletLoaded, name)
+	}
+	wallet, err := LoadWallet(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := wallet.Sync(wm.bc); err != nil {
+		return nil, err
+	}
+	wm.wallets[name] = wallet
+	return wallet, nil
+}
+
+// UnloadWallet unloads the wallet named name, locking it if it is encrypted
+func (wm *WalletManager) UnloadWallet(name string) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	wallet, loaded := wm.wallets[name]
+	if !loaded {
+		return fmt.Errorf("%w: %s", ErrWalletNotLoaded, name)
+	}
+	if wallet.IsEncrypted() {
+		if err := wallet.Lock(); err != nil {
+			return err
+		}
+	}
+	delete(wm.wallets, name)
+	return nil
+}
+
+// Wallet returns the loaded wallet named name
+func (wm *WalletManager) Wallet(name string) (*Wallet, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	wallet, loaded := wm.wallets[name]
+	if !loaded {
+		return nil, fmt.Errorf("%w: %s", ErrWalletNotLoaded, name)
+	}
+	return wallet, nil
+}
+
+// ListWallets lists the wallets saved under config.WalletDir(), ordered by name
+func (wm *WalletManager) ListWallets() ([]WalletInfo, error) {
+	entries, err := os.ReadDir(config.WalletDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	var infos []WalletInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(walletFile(entry.Name())); err != nil {
+			continue
+		}
+		_, loaded := wm.wallets[entry.Name()]
+		infos = append(infos, WalletInfo{Name: entry.Name(), Loaded: loaded})
+	}
+	return infos, nil
+}
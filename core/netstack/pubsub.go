@@ -1,9 +1,7 @@
 package netstack
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
 	"fmt"
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -90,10 +88,8 @@ func blockTopicValidator(ctx context.Context, pid peer.ID, blockMsg *pubsub.Mess
 		return false
 	}
 
-	var tx blkchn.Block
-	dec := gob.NewDecoder(bytes.NewReader(blockMsg.Data))
-	if err := dec.Decode(&tx); err != nil {
-		log.Error("Invalid txMsg: Error decoding transaction message received from: %s\v", blockMsg.GetFrom(), err)
+	if _, err := blkchn.DeserializeBlock(blockMsg.Data); err != nil {
+		log.Errorf("Invalid blockMsg: Error decoding block message received from: %s: %v\n", blockMsg.GetFrom(), err)
 		return false
 	}
 
@@ -106,11 +102,9 @@ func txTopicValidator(ctx context.Context, pid peer.ID, txMsg *pubsub.Message) b
 		return false
 	}
 
-	var tx blkchn.Transaction
-
-	dec := gob.NewDecoder(bytes.NewReader(txMsg.Data))
-	if err := dec.Decode(&tx); err != nil {
-		log.Error("Invalid txMsg: Error decoding transaction message received from: %s\v", txMsg.GetFrom(), err)
+	tx, err := blkchn.DeserializeTransaction(txMsg.Data)
+	if err != nil {
+		log.Errorf("Invalid txMsg: Error decoding transaction message received from: %s: %v\n", txMsg.GetFrom(), err)
 		return false
 	}
 	if !tx.IsValid() {
@@ -1,9 +1,9 @@
 package core
 
 import (
-	"bytes"
+	"bufio"
 	"context"
-	"encoding/gob"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -35,14 +35,124 @@ type Node struct {
 	store      *blkchn.Store
 	chainState *blkchn.ChainState
 	miner      *blkchn.Miner
+	wallets    *blkchn.WalletManager
 }
 
+// SyncRequest asks a peer for the blocks of its main chain following the last block it has in common
+// with the block locator of the requester
 type SyncRequest struct {
-	BlkchnHeight int
+	Locator []string
 }
 
-type SyncResponse struct {
-	Blocks []*blkchn.Block
+const (
+	maxSyncBlockSize = 32 << 20 // bounds the length prefix of a block read from a sync stream
+	maxSyncBlocks    = 500      // number of blocks sent per sync response, a shorter response ends the sync
+	maxLocatorHashes = 64       // bounds the number of hashes of a sync request locator
+	maxLocatorHash   = 64       // bounds the length of a hash of a sync request locator
+)
+
+// writeTo writes the number of locator hashes as an uvarint, followed by each hash prefixed with its length as an uvarint
+func (req SyncRequest) writeTo(w io.Writer) error {
+	buf := binary.AppendUvarint(nil, uint64(len(req.Locator)))
+	for _, hash := range req.Locator {
+		buf = binary.AppendUvarint(buf, uint64(len(hash)))
+		buf = append(buf, hash...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readSyncRequest(r io.Reader) (SyncRequest, error) {
+	br := bufio.NewReader(r)
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return SyncRequest{}, err
+	}
+	if count > maxLocatorHashes {
+		return SyncRequest{}, fmt.Errorf("locator of %d hashes exceeds limit of %d", count, maxLocatorHashes)
+	}
+
+	req := SyncRequest{Locator: make([]string, 0, count)}
+	for range count {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return SyncRequest{}, err
+		}
+		if size > maxLocatorHash {
+			return SyncRequest{}, fmt.Errorf("locator hash of %d bytes exceeds limit of %d", size, maxLocatorHash)
+		}
+		hash := make([]byte, size)
+		if _, err := io.ReadFull(br, hash); err != nil {
+			return SyncRequest{}, err
+		}
+		req.Locator = append(req.Locator, string(hash))
+	}
+	return req, nil
+}
+
+// writeSyncResponse writes up to maxSyncBlocks blocks of the main chain of bc from height from as a
+// sync response: the number of blocks as an uvarint, followed by each block in its canonical encoding
+// prefixed with its length as an uvarint. Blocks are read from the db one at a time.
+func writeSyncResponse(w io.Writer, bc *blkchn.Blockchain, from uint64) error {
+	bw := bufio.NewWriter(w)
+	height := bc.GetBlockchainHeight()
+	if height < 0 || from > uint64(height) {
+		bw.Write(binary.AppendUvarint(nil, 0))
+		return bw.Flush()
+	}
+
+	to := min(uint64(height), from+maxSyncBlocks-1)
+	if _, err := bw.Write(binary.AppendUvarint(nil, to-from+1)); err != nil {
+		return err
+	}
+	err := bc.ForEachBlockInRange(from, to, func(block *blkchn.Block) error {
+		data := block.Serialize()
+		if _, err := bw.Write(binary.AppendUvarint(nil, uint64(len(data)))); err != nil {
+			return err
+		}
+		_, err := bw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readSyncResponse reads a sync response, calling fn with each block as soon as it is decoded.
+// It stops at the first error returned by fn and returns the number of blocks read.
+func readSyncResponse(r io.Reader, fn func(*blkchn.Block) error) (int, error) {
+	br := bufio.NewReader(r)
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, err
+	}
+	if count > maxSyncBlocks {
+		return 0, fmt.Errorf("sync response of %d blocks exceeds limit of %d", count, maxSyncBlocks)
+	}
+
+	for i := 0; i < int(count); i++ {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return i, err
+		}
+		if size > maxSyncBlockSize {
+			return i, fmt.Errorf("block of %d bytes exceeds sync limit", size)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return i, err
+		}
+		block, err := blkchn.DeserializeBlock(data)
+		if err != nil {
+			return i, err
+		}
+		if err := fn(block); err != nil {
+			return i, err
+		}
+	}
+	return int(count), nil
 }
 
 const (
@@ -50,11 +160,11 @@ const (
 	utxoBucket  = "Utxos"
 )
 
-const syncProtocolID = "/blockchain/sync/1.0.0"
+const syncProtocolID = "/blockchain/sync/2.0.0"
 
 var log = logger.NewLogger()
 
-func NewNode(h host.Host, nps *netstack.NodePubSub, store *blkchn.Store, cs *blkchn.ChainState, miner *blkchn.Miner) (*Node, error) {
+func NewNode(h host.Host, nps *netstack.NodePubSub, store *blkchn.Store, cs *blkchn.ChainState, miner *blkchn.Miner, wallets *blkchn.WalletManager) (*Node, error) {
 	if h == nil {
 		return nil, errors.New("Host cannot be nil")
 	}
@@ -67,6 +177,9 @@ func NewNode(h host.Host, nps *netstack.NodePubSub, store *blkchn.Store, cs *blk
 	if cs == nil {
 		return nil, errors.New("Chainstate cannot be nil")
 	}
+	if wallets == nil {
+		return nil, errors.New("Wallet manager cannot be nil")
+	}
 
 	node := &Node{
 		host:       h,
@@ -74,18 +187,13 @@ func NewNode(h host.Host, nps *netstack.NodePubSub, store *blkchn.Store, cs *blk
 		store:      store,
 		chainState: cs,
 		miner:      miner,
+		wallets:    wallets,
 	}
 	return node, nil
 }
 
 func (n *Node) PublishBlock(ctx context.Context, block *blkchn.Block) error {
-	var blockBytes bytes.Buffer
-	err := gob.NewEncoder(&blockBytes).Encode(block)
-	if err != nil {
-		return fmt.Errorf("Error marshalling block to gob %v\n", err)
-	}
-
-	err = n.pubSub.BlockTopic().Publish(ctx, blockBytes.Bytes())
+	err := n.pubSub.BlockTopic().Publish(ctx, block.Serialize())
 	if err != nil {
 		return err
 	}
@@ -94,13 +202,7 @@ func (n *Node) PublishBlock(ctx context.Context, block *blkchn.Block) error {
 }
 
 func (n *Node) PublishTx(ctx context.Context, tx *blkchn.Transaction) error {
-	var txBytes bytes.Buffer
-	err := gob.NewEncoder(&txBytes).Encode(tx)
-	if err != nil {
-		return fmt.Errorf("Error marshalling block to gob %v\n", err)
-	}
-
-	err = n.pubSub.TxTopic().Publish(ctx, txBytes.Bytes())
+	err := n.pubSub.TxTopic().Publish(ctx, tx.Serialize())
 	if err != nil {
 		return err
 	}
@@ -110,28 +212,24 @@ func (n *Node) PublishTx(ctx context.Context, tx *blkchn.Transaction) error {
 
 // RunMiner is an indefinetly running function that contantly mine new blocks
 func (n *Node) RunMiner(ctx context.Context) {
-	bc := n.chainState.Blockchain()
-	mem := n.chainState.Mempool()
 	for {
-		var txs []blkchn.Transaction
-		coinbaseTx := n.miner.GenerateCoinbaseTx()
-		memTxs := n.miner.CollectTransactions(mem, 3) // NOTE: max transaction to collect hardcoded for now.. idk what to do with it
-		txs = append(txs, coinbaseTx)
-		txs = append(txs, memTxs...)
-		block := n.chainState.Blockchain().NewBlock(txs)
+		block := n.miner.NewBlockTemplate(n.chainState, blkchn.MaxBlockTxsSize)
 
 		log.Infof("Mining for new Block:[%d]\n", block.Height)
-		minedBlock := n.miner.MineBlock(block, bc.Difficulty())
+		minedBlock := n.miner.MineBlock(block)
 
 		if minedBlock != nil {
 			log.Infof("Hell yeah!! Block:[%d]:[%s] mined\n", minedBlock.Height, minedBlock.Hash)
 			if err := n.PublishBlock(ctx, minedBlock); err != nil {
-				log.Info("Block:[%d]:[%s] published over the network\n", minedBlock.Height, minedBlock.Hash)
+				log.Infof("Block:[%d]:[%s] published over the network\n", minedBlock.Height, minedBlock.Hash)
 			}
 			if err := n.FinalizeBlock(minedBlock); err != nil {
 				log.Errorf("Failed to finalize block: %v\n", err)
 			} else {
 				log.Infof("Block:[%d]:[%s] finalized\n", minedBlock.Height, minedBlock.Hash)
+				if err := n.miner.RenewAddress(); err != nil {
+					log.Errorf("Failed to renew coinbase address: %v\n", err)
+				}
 			}
 
 		} else {
@@ -166,17 +264,15 @@ func (n *Node) BlockReader(ctx context.Context) {
 			continue
 		}
 
-		var block blkchn.Block
-
-		dec := gob.NewDecoder(bytes.NewReader(blockMsg.Data))
-		if err := dec.Decode(&block); err != nil {
-			log.Error("Error decoding block message received from: %s\v", blockMsg.GetFrom(), err)
+		block, err := blkchn.DeserializeBlock(blockMsg.Data)
+		if err != nil {
+			log.Errorf("Error decoding block message received from: %s: %v\n", blockMsg.GetFrom(), err)
 			continue
 		}
 
 		log.Infof("Received block:[%d]:[%s]: from %s\n", block.Height, block.Hash, blockMsg.GetFrom())
 
-		if err := n.FinalizeBlock(&block); err != nil {
+		if err := n.FinalizeBlock(block); err != nil {
 			log.Errorf("Failed to finalize block: %v\n", err)
 		} else {
 			log.Infof("Block:[%d]:[%s] finalized\n", block.Height, block.Hash)
@@ -199,15 +295,15 @@ func (n *Node) TxReader(ctx context.Context) {
 		if txMsg.GetFrom() == n.host.ID() {
 			continue
 		}
-		var tx blkchn.Transaction
-
-		dec := gob.NewDecoder(bytes.NewReader(txMsg.Data))
-		if err := dec.Decode(&tx); err != nil {
-			log.Error("Error decoding transaction message received from: %s\v", txMsg.GetFrom(), err)
+		tx, err := blkchn.DeserializeTransaction(txMsg.Data)
+		if err != nil {
+			log.Errorf("Error decoding transaction message received from: %s: %v\n", txMsg.GetFrom(), err)
 			continue
 		}
 		log.Infof("Received transaction with id: %s from %s\n", tx.TxID, txMsg.GetFrom())
-		n.chainState.Mempool().AddTx(&tx)
+		if err := n.chainState.AcceptTx(tx); err != nil {
+			log.Errorf("Rejected transaction received from %s: %v\n", txMsg.GetFrom(), err)
+		}
 
 	}
 }
@@ -237,26 +333,16 @@ func (n *Node) GetRandomPeerAddr() (string, error) {
 	return randomPeerAddr, nil
 }
 
+// FinalizeBlock hands the block to the chainstate for validation and connection.
+// If the block causes a chain reorganization, the reorg is published on the EventBus.
 func (n *Node) FinalizeBlock(block *blkchn.Block) error {
-	bc := n.chainState.Blockchain()
-	us := n.chainState.UTXOSet()
-	mem := n.chainState.Mempool()
-
-	if !bc.IsValid(block) {
-		return errors.New("Skipping to add block: Invalid block generated by miner")
-	}
-
-	if err := bc.AddBlock(block); err != nil {
+	reorg, err := n.chainState.ProcessBlock(block)
+	if err != nil {
 		return err
 	}
 
-	if err := us.Update(block.TxData); err != nil {
-		return err
-	}
-	for _, tx := range block.TxData {
-		if tx.IsCoinbase == false {
-			mem.RemoveTx(tx.TxID)
-		}
+	if reorg != nil {
+		EventBus.ReorgFeed.Send(*reorg)
 	}
 
 	return nil
@@ -265,75 +351,83 @@ func (n *Node) FinalizeBlock(block *blkchn.Block) error {
 func (n *Node) HandleSyncRequests() {
 	n.host.SetStreamHandler(syncProtocolID, func(s network.Stream) {
 		defer s.Close()
-		var syncReq SyncRequest
-		if err := gob.NewDecoder(s).Decode(&syncReq); err != nil {
+		syncReq, err := readSyncRequest(s)
+		if err != nil {
 			log.Error("Error decoding sync request: ", err)
 			return
 		}
 
-		// Send the requested blocks
-		bc := n.chainState.Blockchain()
-		blkchnHeight := n.chainState.Blockchain().GetBlockchainHeight()
-		var resp SyncResponse
-		if syncReq.BlkchnHeight == -1 {
-			resp = SyncResponse{Blocks: bc.Chain()}
-		} else if syncReq.BlkchnHeight == blkchnHeight {
-			resp = SyncResponse{}
-		} else {
-			resp = SyncResponse{
-				Blocks: bc.Chain()[syncReq.BlkchnHeight+1:],
-			}
+		// Send the blocks following the fork point, the whole chain if the requester shares no block with it
+		from := uint64(0)
+		if fork, found := n.chainState.Blockchain().FindFork(syncReq.Locator); found {
+			from = fork + 1
 		}
-		if err := gob.NewEncoder(s).Encode(resp); err != nil {
+		if err := writeSyncResponse(s, n.chainState.Blockchain(), from); err != nil {
 			log.Error("Error sending sync response:", err)
 		}
 
 	})
 }
 
-func (node *Node) requestBlocks(ctx context.Context, peerID peer.ID, blkchnHeight int) ([]*blkchn.Block, error) {
+// requestBlocks requests the blocks of the main chain of the peer following its fork point with locator,
+// calling fn with each block as it arrives. It returns the number of blocks received, at most maxSyncBlocks.
+func (node *Node) requestBlocks(ctx context.Context, peerID peer.ID, locator []string, fn func(*blkchn.Block) error) (int, error) {
 	s, err := node.host.NewStream(ctx, peerID, syncProtocolID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer s.Close()
 
-	syncReq := SyncRequest{BlkchnHeight: blkchnHeight}
+	syncReq := SyncRequest{Locator: locator}
 
-	if err := gob.NewEncoder(s).Encode(&syncReq); err != nil {
-		return nil, err
+	if err := syncReq.writeTo(s); err != nil {
+		return 0, err
 	}
 
-	var syncResp SyncResponse
-	if err := gob.NewDecoder(s).Decode(&syncResp); err != nil {
-		return nil, err
-	}
-
-	log.Infof("Received %d blocks during sync", len(syncResp.Blocks))
-	return syncResp.Blocks, nil
-}
-
-func (n *Node) SyncBlocksFromPeer(ctx context.Context, peerID peer.ID, blockchainHeight int) error {
-	blocks, err := n.requestBlocks(ctx, peerID, blockchainHeight)
+	count, err := readSyncResponse(s, fn)
 	if err != nil {
-		return err
+		return count, err
 	}
 
-	if len(blocks) == 0 {
-		return nil
-	}
+	log.Infof("Received %d blocks during sync", count)
+	return count, nil
+}
 
-	for _, block := range blocks {
-		if err := n.FinalizeBlock(block); err != nil {
-			log.Error("Error finalising received block:[%d]:[%s] during sync: %v\n", block.Height, block.Hash, err)
-		} else {
-			log.Infof("Block:[%d]:[%s] finalized\n", block.Height, block.Hash)
+// SyncBlocksFromPeer requests the blocks of the main chain of the peer in batches of maxSyncBlocks,
+// processing each block as it arrives, until the peer sends a shorter batch. The first batch starts at the
+// fork point of the peer chain with ours, so a node on a stale branch gets the branch it has to reorg onto.
+// Each following batch continues from the last block received. The sync stops at the first block that fails validation.
+func (n *Node) SyncBlocksFromPeer(ctx context.Context, peerID peer.ID) error {
+	bc := n.chainState.Blockchain()
+	last := ""
+	for {
+		count, err := n.requestBlocks(ctx, peerID, bc.BlockLocator(last), func(block *blkchn.Block) error {
+			err := n.FinalizeBlock(block)
+			switch {
+			case errors.Is(err, blkchn.ErrBlockKnown):
+			case err != nil:
+				return fmt.Errorf("Error finalising received block:[%d]:[%s] during sync: %w", block.Height, block.Hash, err)
+			default:
+				log.Infof("Block:[%d]:[%s] finalized\n", block.Height, block.Hash)
+			}
+			last = block.Hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if count < maxSyncBlocks {
+			return nil
 		}
 	}
-	return nil
 }
 
-func InitNode(ctx context.Context, port int, id string, randseed int64, mine bool) (*Node, error) {
+// InitNode initialises a node along with its store, chain state and wallet manager, which loads the
+// node wallet named after the host ID. When mnemonic is set, the node wallet is restored from it and
+// mnemonicPassphrase, otherwise a new wallet is created under mnemonicPassphrase unless one was saved
+// before. Created, restored and unencrypted node wallets are encrypted with walletPassphrase unless it is empty.
+// The address index is kept only if addrIndex is set.
+func InitNode(ctx context.Context, port int, id string, randseed int64, mine bool, mnemonic, mnemonicPassphrase, walletPassphrase string, addrIndex bool) (*Node, error) {
 	var err error
 	if id != "" {
 		onlinePeers, err := netstack.ReadOnlinePeers()
@@ -349,12 +443,12 @@ func InitNode(ctx context.Context, port int, id string, randseed int64, mine boo
 	if id != "" {
 		priv, err = netstack.LoadNodePrivKey(id)
 		if err != nil {
-			return nil, fmt.Errorf("No node found for the given id: ", err)
+			return nil, fmt.Errorf("No node found for the given id: %v", err)
 		}
 	} else {
 		priv, err = netstack.GeneratePrivKeyForNode(randseed)
 		if err != nil {
-			return nil, fmt.Errorf("Error generating private key for node: ", err)
+			return nil, fmt.Errorf("Error generating private key for node: %v", err)
 		}
 	}
 
@@ -382,30 +476,33 @@ func InitNode(ctx context.Context, port int, id string, randseed int64, mine boo
 		return nil, fmt.Errorf("Error creating new chainstate: %v\n", err)
 	}
 
+	if err := cs.BuildTxIndex(); err != nil {
+		return nil, fmt.Errorf("Error building transaction index: %v\n", err)
+	}
+
+	if err := cs.SetAddrIndex(addrIndex); err != nil {
+		return nil, err
+	}
+
+	wallets := blkchn.NewWalletManager(cs.Blockchain())
+	wallet, err := initWallet(wallets, h.ID().String(), mnemonic, mnemonicPassphrase, walletPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
 	var miner *blkchn.Miner
 	if mine {
-		var wallet *blkchn.Wallet
-		wallet, err = blkchn.LoadWallet(h.ID().String())
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				wallet, err = blkchn.NewWallet(h.ID().String())
-				if err != nil {
-					return nil, fmt.Errorf("Error creating wallet for miner\n%v", err)
-				}
-			} else {
-				return nil, fmt.Errorf("Error loading wallet for miner\n%v", err)
-			}
-		}
-
 		be := make(chan blkchn.BlockRecEvent, 1)
 		EventBus.BlockFeed.Subscribe("miner", be)
-		miner, err = initMiner(be, wallet)
+		re := make(chan blkchn.ReorgEvent, 1)
+		EventBus.ReorgFeed.Subscribe("miner", re)
+		miner, err = initMiner(be, re, wallet)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	n, err := NewNode(h, nps, store, cs, miner)
+	n, err := NewNode(h, nps, store, cs, miner, wallets)
 	if err != nil {
 		return nil, err
 	}
@@ -435,8 +532,7 @@ func (n *Node) Connect(ctx context.Context, target string) error {
 			if err != nil {
 				return fmt.Errorf("Error extracting peer id from the peer address:[%s]: %v\n", addr, err)
 			}
-			blockchainHeight := n.chainState.Blockchain().GetBlockchainHeight()
-			err = n.SyncBlocksFromPeer(ctx, peerID, blockchainHeight)
+			err = n.SyncBlocksFromPeer(ctx, peerID)
 			if err != nil {
 				return fmt.Errorf("Error syncing blocks: %v\n", err)
 			}
@@ -488,6 +584,24 @@ func initStore(hostID peer.ID) (*blkchn.Store, error) {
 		return nil, err
 	}
 
+	err = store.CheckVersion()
+	if errors.Is(err, blkchn.ErrLegacyStore) {
+		archived, err := store.Archive()
+		if err != nil {
+			return nil, err
+		}
+		log.Warnf("Store in an older format moved to %s, the chain will be synced again from peers\n", archived)
+
+		store, err = blkchn.NewDb(hostID.String())
+		if err != nil {
+			return nil, err
+		}
+		err = store.CheckVersion()
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	err = store.CreateBlocksBucket()
 	if err != nil {
 		return nil, err
@@ -503,6 +617,21 @@ func initStore(hostID peer.ID) (*blkchn.Store, error) {
 		return nil, err
 	}
 
+	err = store.CreateHeaderBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.CreateUndoBucket()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.CreateDataIndexBucket()
+	if err != nil {
+		return nil, err
+	}
+
 	return store, nil
 }
 
@@ -527,8 +656,63 @@ func initChainState(store *blkchn.Store) (*blkchn.ChainState, error) {
 	return cs, nil
 }
 
-func initMiner(bre <-chan blkchn.BlockRecEvent, minerWallet *blkchn.Wallet) (*blkchn.Miner, error) {
-	miner, err := blkchn.NewMiner(minerWallet, bre)
+func initWallet(wallets *blkchn.WalletManager, id, mnemonic, mnemonicPassphrase, walletPassphrase string) (*blkchn.Wallet, error) {
+	if mnemonic != "" {
+		archived, err := blkchn.ArchiveWallet(id)
+		if err == nil {
+			log.Warnf("Wallet replaced by the restored wallet moved to %s\n", archived)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		wallet, err := wallets.RestoreWallet(id, mnemonic, mnemonicPassphrase, walletPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Error restoring wallet for node\n%v", err)
+		}
+		return wallet, lockNewWallet(wallet)
+	}
+
+	wallet, err := wallets.LoadWallet(id)
+	if errors.Is(err, os.ErrNotExist) {
+		wallet, err = wallets.CreateWallet(id, mnemonicPassphrase, walletPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating wallet for node\n%v", err)
+		}
+		words, err := wallet.Mnemonic()
+		if err != nil {
+			return nil, err
+		}
+		log.Warnf("Created wallet %s, write down its recovery words to restore it: %s\n", id, words)
+		return wallet, lockNewWallet(wallet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error loading wallet for node\n%v", err)
+	}
+
+	if !wallet.IsEncrypted() {
+		if walletPassphrase == "" {
+			log.Warnf("Wallet %s is saved unencrypted, restart with --wallet-passphrase or use encryptwallet to encrypt it\n", id)
+			return wallet, nil
+		}
+		if err := wallet.Encrypt(walletPassphrase); err != nil {
+			return nil, fmt.Errorf("Error encrypting wallet for node\n%v", err)
+		}
+		log.Infof("Encrypted unencrypted wallet %s\n", id)
+	}
+	return wallet, nil
+}
+
+// lockNewWallet locks a wallet created or restored encrypted, or warns that it is saved unencrypted
+func lockNewWallet(wallet *blkchn.Wallet) error {
+	if !wallet.IsEncrypted() {
+		log.Warnf("Wallet %s is saved unencrypted, use encryptwallet to encrypt it\n", wallet.Id)
+		return nil
+	}
+	return wallet.Lock()
+}
+
+func initMiner(bre <-chan blkchn.BlockRecEvent, re <-chan blkchn.ReorgEvent, minerWallet *blkchn.Wallet) (*blkchn.Miner, error) {
+	miner, err := blkchn.NewMiner(minerWallet, bre, re)
 	if err != nil {
 		return nil, fmt.Errorf("Error initialising miner %v\n", err)
 	}
@@ -548,33 +732,256 @@ func listenForQuitSignal(ctx context.Context, cancel context.CancelFunc) {
 	}()
 }
 
+// GetBlockByHash reads the main chain block with the given hash from the db, or returns nil if there is none
 func (n *Node) GetBlockByHash(hash string) *blkchn.Block {
-	var block blkchn.Block
-
-	index := n.chainState.Blockchain().Index()
-
-	if blockHeight, exists := index[hash]; !exists {
+	bc := n.chainState.Blockchain()
+	if _, ok := bc.MainChainHeight(hash); !ok {
 		return nil
-	} else {
-		chain := n.chainState.Blockchain().Chain()
-		block = *chain[blockHeight]
 	}
 
-	return &block
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		log.Errorf("Error reading block:[%s]: %v\n", hash, err)
+		return nil
+	}
+	return block
 }
 
+// GetBlockByHeight reads the main chain block at height from the db, or returns nil if there is none
 func (n *Node) GetBlockByHeight(height uint64) *blkchn.Block {
-	var block blkchn.Block
-	chain := n.chainState.Blockchain().Chain()
-
-	if len(chain) == 0 || height+1 > uint64(len(chain)) {
+	bc := n.chainState.Blockchain()
+	if int(height) > bc.GetBlockchainHeight() {
 		return nil
 	}
 
-	block = *chain[int(height)]
-	if block.Height != height {
+	block, err := bc.GetBlockByHeight(height)
+	if err != nil {
+		log.Errorf("Error reading block at height %d: %v\n", height, err)
 		return nil
 	}
+	return block
+}
+
+// GetBalance returns the spendable and immature balance of address
+func (n *Node) GetBalance(address string) *blkchn.Balance {
+	bal := n.chainState.Balance(address)
+	return &bal
+}
+
+// wallet returns the loaded wallet named name, or the node wallet named after the host ID if name is empty
+func (n *Node) wallet(name string) (*blkchn.Wallet, error) {
+	if name == "" {
+		name = n.host.ID().String()
+	}
+	return n.wallets.Wallet(name)
+}
+
+// RescanWallet rebuilds the outputs and history of the node wallet from the main chain, such as after
+// the wallet was restored, and logs the balance found
+func (n *Node) RescanWallet() error {
+	wallet, err := n.wallet("")
+	if err != nil {
+		return err
+	}
+	found, err := wallet.Rescan(n.chainState.Blockchain())
+	if err != nil {
+		return fmt.Errorf("Error rescanning wallet: %v", err)
+	}
+	bal, err := wallet.Balance(n.chainState.Blockchain())
+	if err != nil {
+		return err
+	}
+	log.Infof("Wallet rescan found %d transactions, balance: %d spendable, %d immature\n", found, bal.Spendable, bal.Immature)
+	return nil
+}
+
+// CreateWallet creates and loads a new wallet named name and returns its recovery words.
+// Unless walletPassphrase is empty, the wallet is encrypted with it and locked.
+func (n *Node) CreateWallet(name, mnemonicPassphrase, walletPassphrase string) (string, error) {
+	wallet, err := n.wallets.CreateWallet(name, mnemonicPassphrase, walletPassphrase)
+	if err != nil {
+		return "", err
+	}
+	words, err := wallet.Mnemonic()
+	if err != nil {
+		return "", err
+	}
+	return words, lockNewWallet(wallet)
+}
+
+// RestoreWallet restores the wallet named name from its recovery words, loads it and rescans the main chain
+// for its outputs. Unless walletPassphrase is empty, the wallet is encrypted with it and locked.
+func (n *Node) RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase string) error {
+	wallet, err := n.wallets.RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase)
+	if err != nil {
+		return err
+	}
+	return lockNewWallet(wallet)
+}
+
+// LoadWallet loads the wallet saved under name
+func (n *Node) LoadWallet(name string) error {
+	wallet, err := n.wallets.LoadWallet(name)
+	if err != nil {
+		return err
+	}
+	if !wallet.IsEncrypted() {
+		log.Warnf("Wallet %s is saved unencrypted, use encryptwallet to encrypt it\n", name)
+	}
+	return nil
+}
+
+// UnloadWallet unloads the wallet named name. The node wallet cannot be unloaded while the miner pays to it.
+func (n *Node) UnloadWallet(name string) error {
+	if n.miner != nil && name == n.host.ID().String() {
+		return fmt.Errorf("wallet %s is used by the miner", name)
+	}
+	return n.wallets.UnloadWallet(name)
+}
+
+// ListWallets lists the saved wallets and whether they are loaded
+func (n *Node) ListWallets() ([]blkchn.WalletInfo, error) {
+	return n.wallets.ListWallets()
+}
+
+// GetWalletBalance returns the spendable and immature balance of the wallet named name
+func (n *Node) GetWalletBalance(name string) (*blkchn.Balance, error) {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return nil, err
+	}
+	bal, err := wallet.Balance(n.chainState.Blockchain())
+	if err != nil {
+		return nil, err
+	}
+	return &bal, nil
+}
+
+// GetWalletHistory returns the transactions of the wallet named name on the main chain, oldest first
+func (n *Node) GetWalletHistory(name string) ([]blkchn.WalletTx, error) {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.History(n.chainState.Blockchain())
+}
+
+// EncryptWallet encrypts the wallet named name with passphrase, which locks it
+func (n *Node) EncryptWallet(name, passphrase string) error {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return err
+	}
+	return wallet.Encrypt(passphrase)
+}
+
+// UnlockWallet unlocks the wallet named name for timeout, so that it can spend and sign
+func (n *Node) UnlockWallet(name, passphrase string, timeout time.Duration) error {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return err
+	}
+	return wallet.Unlock(passphrase, timeout)
+}
+
+// LockWallet locks the wallet named name
+func (n *Node) LockWallet(name string) error {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return err
+	}
+	return wallet.Lock()
+}
+
+// ChangeWalletPassphrase encrypts the wallet named name with newPassphrase instead of oldPassphrase
+func (n *Node) ChangeWalletPassphrase(name, oldPassphrase, newPassphrase string) error {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return err
+	}
+	return wallet.ChangePassphrase(oldPassphrase, newPassphrase)
+}
+
+// NewAddress returns a fresh receiving address of the wallet named name
+func (n *Node) NewAddress(name string) (string, error) {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return "", err
+	}
+	return wallet.NewAddress()
+}
+
+// SendData anchors data on the chain in a data carrier output of a transaction paid for by the wallet named name.
+// The transaction pays fee, or feeRate per byte if feeRate is positive. It is added to the mempool and published,
+// and its id is returned.
+func (n *Node) SendData(ctx context.Context, name string, data []byte, fee, feeRate int) (string, error) {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return "", err
+	}
+	tx, err := wallet.CreateDataTransaction(n.chainState, data, fee, feeRate)
+	if err != nil {
+		return "", err
+	}
+	return n.submitTx(ctx, tx)
+}
+
+// Send pays amount to recipient from the wallet named name with a transaction paying fee, or feeRate per byte
+// if feeRate is positive. The transaction is added to the mempool and published, and its id is returned.
+func (n *Node) Send(ctx context.Context, name, recipient string, amount, fee, feeRate int) (string, error) {
+	wallet, err := n.wallet(name)
+	if err != nil {
+		return "", err
+	}
+	tx, err := wallet.CreateTransaction(n.chainState, recipient, amount, fee, feeRate)
+	if err != nil {
+		return "", err
+	}
+	return n.submitTx(ctx, tx)
+}
+
+// submitTx adds a transaction created by the node to the mempool and publishes it
+func (n *Node) submitTx(ctx context.Context, tx *blkchn.Transaction) (string, error) {
+	if err := n.chainState.AcceptTx(tx); err != nil {
+		return "", err
+	}
+	if err := n.PublishTx(ctx, tx); err != nil {
+		return "", fmt.Errorf("Error publishing transaction:[%s]: %v", tx.TxID, err)
+	}
+	return tx.TxID, nil
+}
+
+// FindData returns the data carrier outputs on the main chain carrying data
+func (n *Node) FindData(data []byte) ([]blkchn.DataRecord, error) {
+	return n.store.FindData(data)
+}
+
+// GetTransaction returns the transaction with id txID along with its block and confirmations
+func (n *Node) GetTransaction(txID string) (*blkchn.TxInfo, error) {
+	return n.chainState.GetTransaction(txID)
+}
+
+// GetAddressBalance returns the balance of address from the address index
+func (n *Node) GetAddressBalance(address string) (*blkchn.Balance, error) {
+	bal, err := n.chainState.AddressBalance(address)
+	if err != nil {
+		return nil, err
+	}
+	return &bal, nil
+}
+
+// GetAddressUTXOs returns the utxos of address from the address index
+func (n *Node) GetAddressUTXOs(address string) ([]blkchn.UTXO, error) {
+	return n.chainState.AddressUTXOs(address)
+}
+
+// GetAddressHistory returns count transactions of address from the address index, newest first, after skipping skip
+func (n *Node) GetAddressHistory(address string, skip, count int) ([]blkchn.AddressTx, error) {
+	return n.chainState.AddressHistory(address, skip, count)
+}
 
-	return &block
+// GetTxOutSetInfo returns statistics of the utxo set, including the total coins issued
+func (n *Node) GetTxOutSetInfo() *blkchn.TxOutSetInfo {
+	info := n.chainState.TxOutSetInfo()
+	return &info
 }
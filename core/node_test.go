@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	blkchn "github.com/shu8h0-null/minbit/core/blockchain"
+)
+
+// syncResponse encodes blocks as a sync response announcing count blocks
+func syncResponse(count int, blocks ...*blkchn.Block) *bytes.Buffer {
+	buf := bytes.NewBuffer(binary.AppendUvarint(nil, uint64(count)))
+	for _, block := range blocks {
+		data := block.Serialize()
+		buf.Write(binary.AppendUvarint(nil, uint64(len(data))))
+		buf.Write(data)
+	}
+	return buf
+}
+
+func TestReadSyncResponse(t *testing.T) {
+	blocks := []*blkchn.Block{
+		{Height: 1},
+		{Height: 2},
+		{Height: 3},
+	}
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name      string
+		resp      *bytes.Buffer
+		stopAt    uint64 // height at which fn fails, 0 if it never does
+		wantCount int
+		wantSeen  int
+		wantErr   bool
+	}{
+		{"all blocks", syncResponse(3, blocks...), 0, 3, 3, false},
+		{"empty", syncResponse(0), 0, 0, 0, false},
+		{"fn fails", syncResponse(3, blocks...), 2, 1, 2, true},
+		{"truncated", syncResponse(3, blocks[:2]...), 0, 2, 2, true},
+		{"count above limit", syncResponse(maxSyncBlocks+1, blocks...), 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := 0
+			count, err := readSyncResponse(tt.resp, func(block *blkchn.Block) error {
+				seen++
+				if block.Height != blocks[seen-1].Height {
+					t.Errorf("block %d at height %d, want %d", seen, block.Height, blocks[seen-1].Height)
+				}
+				if block.Height == tt.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr || count != tt.wantCount || seen != tt.wantSeen {
+				t.Errorf("readSyncResponse = %d, %v with %d blocks processed, want %d with %d processed",
+					count, err, seen, tt.wantCount, tt.wantSeen)
+			}
+			if tt.stopAt != 0 && !errors.Is(err, errStop) {
+				t.Errorf("readSyncResponse error = %v, want %v", err, errStop)
+			}
+		})
+	}
+}
+
+func TestSyncRequestRoundTrip(t *testing.T) {
+	for _, locator := range [][]string{{}, {"aa"}, {strings.Repeat("ab", 32), strings.Repeat("cd", 32)}} {
+		var buf bytes.Buffer
+		if err := (SyncRequest{Locator: locator}).writeTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		req, err := readSyncRequest(&buf)
+		if err != nil || !slices.Equal(req.Locator, locator) {
+			t.Errorf("readSyncRequest = %v, %v, want %v", req.Locator, err, locator)
+		}
+	}
+}
+
+func TestReadSyncRequestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		locator []string
+	}{
+		{"too many hashes", make([]string, maxLocatorHashes+1)},
+		{"hash too long", []string{strings.Repeat("a", maxLocatorHash+1)}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := (SyncRequest{Locator: tt.locator}).writeTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readSyncRequest(&buf); err == nil {
+			t.Errorf("%s: readSyncRequest accepted the request", tt.name)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package rpc
 
 import (
+	"context"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/shu8h0-null/minbit/core/blockchain"
@@ -25,6 +29,119 @@ func (h RPCHandler) GetBlockByHeight(height uint64) *blockchain.Block {
 	return h.rpcServer.GetBlockByHeight(height)
 }
 
+func (h RPCHandler) GetTxOutSetInfo() *blockchain.TxOutSetInfo {
+	return h.rpcServer.GetTxOutSetInfo()
+}
+
+func (h RPCHandler) GetBalance(address string) *blockchain.Balance {
+	return h.rpcServer.GetBalance(address)
+}
+
+// Wallet RPCs act on the loaded wallet named by their wallet parameter, or on the node wallet
+// named after the host ID when it is empty.
+
+// CreateWallet creates and loads a new wallet and returns its recovery words.
+// Unless walletPassphrase is empty, the wallet is encrypted with it.
+func (h RPCHandler) CreateWallet(name, mnemonicPassphrase, walletPassphrase string) (string, error) {
+	return h.rpcServer.CreateWallet(name, mnemonicPassphrase, walletPassphrase)
+}
+
+// RestoreWallet restores a wallet from its recovery words and loads it.
+// Unless walletPassphrase is empty, the wallet is encrypted with it.
+func (h RPCHandler) RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase string) error {
+	return h.rpcServer.RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase)
+}
+
+func (h RPCHandler) LoadWallet(name string) error {
+	return h.rpcServer.LoadWallet(name)
+}
+
+func (h RPCHandler) UnloadWallet(name string) error {
+	return h.rpcServer.UnloadWallet(name)
+}
+
+func (h RPCHandler) ListWallets() ([]blockchain.WalletInfo, error) {
+	return h.rpcServer.ListWallets()
+}
+
+// GetWalletBalance returns the spendable and immature balance of a wallet
+func (h RPCHandler) GetWalletBalance(wallet string) (*blockchain.Balance, error) {
+	return h.rpcServer.GetWalletBalance(wallet)
+}
+
+// GetWalletHistory returns the transactions of a wallet on the main chain, oldest first
+func (h RPCHandler) GetWalletHistory(wallet string) ([]blockchain.WalletTx, error) {
+	return h.rpcServer.GetWalletHistory(wallet)
+}
+
+// NewAddress returns a fresh receiving address of a wallet
+func (h RPCHandler) NewAddress(wallet string) (string, error) {
+	return h.rpcServer.NewAddress(wallet)
+}
+
+// EncryptWallet encrypts a wallet with passphrase, which locks it
+func (h RPCHandler) EncryptWallet(wallet, passphrase string) error {
+	return h.rpcServer.EncryptWallet(wallet, passphrase)
+}
+
+// UnlockWallet unlocks a wallet for timeout seconds, so that it can spend and sign
+func (h RPCHandler) UnlockWallet(wallet, passphrase string, timeout int) error {
+	return h.rpcServer.UnlockWallet(wallet, passphrase, time.Duration(timeout)*time.Second)
+}
+
+func (h RPCHandler) LockWallet(wallet string) error {
+	return h.rpcServer.LockWallet(wallet)
+}
+
+// ChangeWalletPassphrase encrypts a wallet with newPassphrase instead of oldPassphrase
+func (h RPCHandler) ChangeWalletPassphrase(wallet, oldPassphrase, newPassphrase string) error {
+	return h.rpcServer.ChangeWalletPassphrase(wallet, oldPassphrase, newPassphrase)
+}
+
+// Send pays amount to recipient from a wallet and returns the id of the transaction.
+// The transaction pays fee, or feeRate per byte if feeRate is positive.
+func (h RPCHandler) Send(ctx context.Context, wallet, recipient string, amount, fee, feeRate int) (string, error) {
+	return h.rpcServer.Send(ctx, wallet, recipient, amount, fee, feeRate)
+}
+
+// SendData anchors the hex encoded data on the chain, paid for by a wallet, and returns the id of the transaction carrying it
+func (h RPCHandler) SendData(ctx context.Context, wallet, data string, fee, feeRate int) (string, error) {
+	payload, err := hex.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding data hex: %v", err)
+	}
+	return h.rpcServer.SendData(ctx, wallet, payload, fee, feeRate)
+}
+
+// FindData returns the data carrier outputs on the main chain carrying the hex encoded data
+func (h RPCHandler) FindData(data string) ([]blockchain.DataRecord, error) {
+	payload, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding data hex: %v", err)
+	}
+	return h.rpcServer.FindData(payload)
+}
+
+// GetTransaction returns a transaction by id along with its block and confirmations
+func (h RPCHandler) GetTransaction(txID string) (*blockchain.TxInfo, error) {
+	return h.rpcServer.GetTransaction(txID)
+}
+
+// GetAddressBalance returns the balance of an address, which requires the address index
+func (h RPCHandler) GetAddressBalance(address string) (*blockchain.Balance, error) {
+	return h.rpcServer.GetAddressBalance(address)
+}
+
+// GetAddressUTXOs returns the utxos of an address, which requires the address index
+func (h RPCHandler) GetAddressUTXOs(address string) ([]blockchain.UTXO, error) {
+	return h.rpcServer.GetAddressUTXOs(address)
+}
+
+// GetAddressHistory returns a page of the transactions of an address, newest first, which requires the address index
+func (h RPCHandler) GetAddressHistory(address string, skip, count int) ([]blockchain.AddressTx, error) {
+	return h.rpcServer.GetAddressHistory(address, skip, count)
+}
+
 func StartRPC(addr string, handler *RPCHandler) error {
 	mux := http.NewServeMux()
 	rpcServer := jsonrpc.NewServer()
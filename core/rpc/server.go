@@ -1,8 +1,34 @@
 package rpc
 
-import "github.com/shu8h0-null/minbit/core/blockchain"
+import (
+	"context"
+	"time"
+
+	"github.com/shu8h0-null/minbit/core/blockchain"
+)
 
 type server interface {
 	GetBlockByHash(hash string) *blockchain.Block
 	GetBlockByHeight(height uint64) *blockchain.Block
+	GetTxOutSetInfo() *blockchain.TxOutSetInfo
+	GetBalance(address string) *blockchain.Balance
+	CreateWallet(name, mnemonicPassphrase, walletPassphrase string) (string, error)
+	RestoreWallet(name, mnemonic, mnemonicPassphrase, walletPassphrase string) error
+	LoadWallet(name string) error
+	UnloadWallet(name string) error
+	ListWallets() ([]blockchain.WalletInfo, error)
+	GetWalletBalance(wallet string) (*blockchain.Balance, error)
+	GetWalletHistory(wallet string) ([]blockchain.WalletTx, error)
+	NewAddress(wallet string) (string, error)
+	EncryptWallet(wallet, passphrase string) error
+	UnlockWallet(wallet, passphrase string, timeout time.Duration) error
+	LockWallet(wallet string) error
+	ChangeWalletPassphrase(wallet, oldPassphrase, newPassphrase string) error
+	Send(ctx context.Context, wallet, recipient string, amount, fee, feeRate int) (string, error)
+	SendData(ctx context.Context, wallet string, data []byte, fee, feeRate int) (string, error)
+	FindData(data []byte) ([]blockchain.DataRecord, error)
+	GetTransaction(txID string) (*blockchain.TxInfo, error)
+	GetAddressBalance(address string) (*blockchain.Balance, error)
+	GetAddressUTXOs(address string) ([]blockchain.UTXO, error)
+	GetAddressHistory(address string, skip, count int) ([]blockchain.AddressTx, error)
 }
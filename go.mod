@@ -8,6 +8,7 @@ require (
 	github.com/libp2p/go-libp2p-pubsub v0.12.0
 	github.com/mr-tron/base58 v1.2.0
 	github.com/multiformats/go-multiaddr v0.13.0
+	github.com/tyler-smith/go-bip39 v1.1.0
 	github.com/urfave/cli/v3 v3.3.8
 	go.etcd.io/bbolt v1.4.0
 	golang.org/x/crypto v0.33.0